@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// EnableCSVOutput changes the Execute behavior to write a CSV row for every value found by
+// the template, e.g. every item of {.items[*]} or every iteration of a range. The cells of
+// a row are the results of the given column templates, e.g. {.metadata.name}, executed on
+// that value. Cells holding commas, quotes or newlines are quoted. Without columns, every
+// value is written as a row of a single cell. The text of the template is skipped.
+func (j *JSONPath) EnableCSVOutput(columns []string) {
+	j.outputCSV = true
+	j.outputYAML = false
+	j.outputJSON = false
+	j.condensedJSON = false
+	j.csvColumns = columns
+}
+
+// executeCSV writes the results of the template as CSV rows, it must be called on an execution
+func (j *JSONPath) executeCSV(wr io.Writer, data interface{}) error {
+	columns := make([]*JSONPath, 0, len(j.csvColumns))
+	for _, column := range j.csvColumns {
+		col := j.cellTemplate()
+		if err := col.Parse(column); err != nil {
+			return fmt.Errorf("invalid CSV column %s: %v", column, err)
+		}
+		columns = append(columns, col)
+	}
+	w := csv.NewWriter(wr)
+	err := j.visit(data, func(results []located) error {
+		for _, r := range results {
+			if r.text {
+				continue
+			}
+			row, err := j.csvRow(r.value, columns)
+			if err != nil {
+				return err
+			}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return j.continuedErrors()
+}
+
+// cellTemplate returns a copy of the template printing a single cell of a CSV row
+func (j *JSONPath) cellTemplate() *JSONPath {
+	cell := j.execution()
+	cell.outputCSV = false
+	cell.outputYAML = false
+	cell.csvColumns = nil
+	cell.maxOutputBytes = 0
+	cell.labelQueries = false
+	cell.recorded = nil
+	return cell
+}
+
+// csvRow returns the cells of the row of the given value
+func (j *JSONPath) csvRow(value reflect.Value, columns []*JSONPath) ([]string, error) {
+	if len(columns) == 0 {
+		var buf bytes.Buffer
+		if err := j.cellTemplate().PrintResults(&buf, []reflect.Value{value}); err != nil {
+			return nil, err
+		}
+		return []string{buf.String()}, nil
+	}
+	var data interface{}
+	if value.IsValid() && value.CanInterface() {
+		data = value.Interface()
+	}
+	row := make([]string, 0, len(columns))
+	for _, col := range columns {
+		cell := col.execution()
+		fullResults, err := cell.run(data)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		for _, results := range fullResults {
+			if err := cell.PrintResults(&buf, values(results)); err != nil {
+				return nil, err
+			}
+		}
+		// failed cells hold the error marker, see ContinueOnError
+		j.continuedErrs = append(j.continuedErrs, cell.continuedErrs...)
+		row = append(row, buf.String())
+	}
+	return row, nil
+}
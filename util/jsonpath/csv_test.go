@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVOutput(t *testing.T) {
+	var input = []byte(`{
+	  "kind": "List",
+	  "items": [
+		{"metadata": {"name": "web"}, "status": {"phase": "Running", "replicas": 3}},
+		{"metadata": {"name": "db, primary"}, "status": {"phase": "Pending"}},
+		{"metadata": {"name": "say \"hi\""}, "status": {"phase": "Failed\nretrying"}}
+	  ]
+	}`)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		columns     []string
+		expect      string
+		expectError bool
+	}{
+		{"range", `{range .items[*]}{@}{end}`, []string{"{.metadata.name}", "{.status.phase}"},
+			"web,Running\n\"db, primary\",Pending\n\"say \"\"hi\"\"\",\"Failed\nretrying\"\n", false},
+		{"wildcard", `{.items[*]}`, []string{"{.metadata.name}", "{.status.phase}"},
+			"web,Running\n\"db, primary\",Pending\n\"say \"\"hi\"\"\",\"Failed\nretrying\"\n", false},
+		{"text is skipped", `items: {.items[0]}`, []string{"{.metadata.name}", "{.status.replicas}"},
+			"web,3\n", false},
+		{"no columns", `{.items[*].metadata.name}`, nil,
+			"web\n\"db, primary\"\n\"say \"\"hi\"\"\"\n", false},
+		{"missing column", `{.items[*]}`, []string{"{.metadata.name}", "{.status.replicas}"}, "", true},
+		{"invalid column", `{.items[*]}`, []string{"{.metadata.name"}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j := New(test.name)
+			if err := j.Parse(test.template); err != nil {
+				t.Fatalf("parse %s error %v", test.template, err)
+			}
+			j.EnableCSVOutput(test.columns)
+			buf := new(bytes.Buffer)
+			err := j.Execute(buf, data)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error, got %q", buf.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("execute %s error %v", test.template, err)
+			}
+			if out := buf.String(); out != test.expect {
+				t.Errorf("expected %q, got %q", test.expect, out)
+			}
+		})
+	}
+}
+
+func TestCSVOutputIsValid(t *testing.T) {
+	var input = []byte(`{"items": [
+		{"metadata": {"name": "a,b"}, "status": {"phase": "Running"}},
+		{"metadata": {"name": "c\"d"}, "status": {"phase": "line\nbreak"}}
+	]}`)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		t.Fatal(err)
+	}
+	j := New("csv")
+	if err := j.Parse(`{range .items[*]}{@}{"\n"}{end}`); err != nil {
+		t.Fatal(err)
+	}
+	j.EnableCSVOutput([]string{"{.metadata.name}", "{.status.phase}"})
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV %q: %v", buf.String(), err)
+	}
+	expect := [][]string{{"a,b", "Running"}, {"c\"d", "line\nbreak"}}
+	if !reflect.DeepEqual(records, expect) {
+		t.Errorf("expected %q, got %q", expect, records)
+	}
+}
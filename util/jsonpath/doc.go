@@ -17,4 +17,25 @@ limitations under the License.
 // package jsonpath is a template engine using jsonpath syntax,
 // which can be seen at http://goessner.net/articles/JsonPath/.
 // In addition, it has {range} {end} function to iterate list and slice.
+//
+// New, Parse, Execute, FindResults, PrintResults, AllowMissingKeys and EnableJSONOutput
+// keep the signatures of the upstream k8s.io/client-go/util/jsonpath package, so existing
+// callers compile unchanged. Templates behave the same, except that:
+//
+//   - $name refers to a variable bound with BindVariable instead of the field name of
+//     the current object, and name(...) calls a function, whose name may have a
+//     namespace like ns.name(...) or ns:name(...)
+//   - $ at the start of a filter operand or function argument refers to the root of the
+//     data instead of the current object, e.g. {.items[?(@.name in $.selected[*])]}
+//   - a template containing {range} can be executed more than once
+//   - | passes the results of an action to a function, e.g. {.items[*].cpu | sum}, so
+//     field names containing | have to be quoted, e.g. {['a|b']}. Unquoted names like
+//     {.a|b}, where b is not a function, fail to parse.
+//   - ^ selects the value containing the current object, e.g. {..isbn^.title}, so field
+//     names containing ^ have to be quoted or escaped, e.g. {.a\^b}. Unquoted names like
+//     {.a^b} fail to parse.
+//   - /* ... */ inside an action is a comment where whitespace may appear, e.g.
+//     {.items[?( /* running only */ @.status.phase=="Running")]}
+//   - {include "name"} prints the output of the template registered with
+//     RegisterSubTemplate as name, executed on the current object
 package jsonpath // import "k8s.io/client-go/util/jsonpath"
@@ -0,0 +1,1102 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/third_party/forked/golang/template"
+)
+
+// Function is a function which can be called inside a template or a filter,
+// e.g. {count(.items[*])}. Each argument holds the results of evaluating the
+// corresponding argument against the current object.
+type Function func(args ...[]reflect.Value) ([]reflect.Value, error)
+
+// UnknownFunctionHandler is called for every function call whose name is not registered.
+type UnknownFunctionHandler func(name string, args ...[]reflect.Value) ([]reflect.Value, error)
+
+// builtinFunctions are callable from every template unless a function with
+// the same name is registered with RegisterFunction or it is unregistered.
+var builtinFunctions = map[string]Function{
+	"match":           regexpMatcher("match", true),
+	"search":          regexpMatcher("search", false),
+	"is_regex":        isRegex,
+	"fold_ascii":      foldASCII,
+	"type":            typeOf,
+	"coalesce":        coalesce,
+	"sum":             sum,
+	"avg":             avg,
+	"distinct_values": distinct("distinct_values"),
+	"unique":          distinct("unique"),
+	"min":             minValue,
+	"max":             maxValue,
+	"keys":            keys,
+	"divisible_by":    divisibleBy,
+	"percent":         percent,
+	"age":             age,
+	"abs":             numeric("abs", absInt, math.Abs),
+	"floor":           numeric("floor", identityInt, math.Floor),
+	"ceil":            numeric("ceil", identityInt, math.Ceil),
+	"round":           numeric("round", identityInt, math.Round),
+	"lower":           stringTransform("lower", strings.ToLower),
+	"upper":           stringTransform("upper", strings.ToUpper),
+	"trim":            stringTransform("trim", strings.TrimSpace),
+	"b64enc":          stringTransform("b64enc", base64Encode),
+	"b64dec":          base64Decode,
+	"urlquery":        stringTransform("urlquery", url.QueryEscape),
+	"split":           split,
+	"join":            join,
+	"first":           first,
+	"last":            last,
+	"sort":            sortValues,
+	"window":          window,
+	"value":           valueOf,
+}
+
+// quantifiers are builtin functions testing all values of their first argument against the
+// filter expression given as second argument, e.g. {[?(all(@[*], "@ > 0"))]}. Each decides
+// the result from the number of matching values and the number of all values.
+var quantifiers = map[string]func(matched, total int) bool{
+	"all": func(matched, total int) bool { return matched == total },
+	"any": func(matched, total int) bool { return matched > 0 },
+}
+
+// Arity is the number of arguments a function accepts. A negative Max accepts any number
+// of arguments from Min on.
+type Arity struct {
+	Min, Max int
+}
+
+// toleratesMissingArgs are the builtin functions whose arguments may refer to missing keys
+// even if AllowMissingKeys is not set, e.g. {coalesce(.nickname, .name)}
+var toleratesMissingArgs = map[string]bool{
+	"coalesce": true,
+}
+
+// builtinArities are checked when parsing calls of builtin functions, so that a wrong number
+// of arguments fails before the template is executed.
+var builtinArities = map[string]Arity{
+	"match":           {2, 3},
+	"search":          {2, 3},
+	"is_regex":        {1, 1},
+	"fold_ascii":      {1, 1},
+	"type":            {1, 1},
+	"coalesce":        {1, -1},
+	"sum":             {1, 1},
+	"avg":             {1, 1},
+	"distinct_values": {1, 1},
+	"unique":          {1, 1},
+	"min":             {1, 1},
+	"max":             {1, 1},
+	"keys":            {1, 1},
+	"divisible_by":    {2, 2},
+	"percent":         {2, 2},
+	"age":             {1, 1},
+	"abs":             {1, 1},
+	"floor":           {1, 1},
+	"ceil":            {1, 1},
+	"round":           {1, 1},
+	"lower":           {1, 1},
+	"upper":           {1, 1},
+	"trim":            {1, 1},
+	"b64enc":          {1, 1},
+	"b64dec":          {1, 1},
+	"urlquery":        {1, 1},
+	"split":           {2, 2},
+	"join":            {2, 2},
+	"first":           {1, 1},
+	"last":            {1, 1},
+	"sort":            {1, 1},
+	"window":          {3, 3},
+	"value":           {1, 1},
+	"all":             {2, 2},
+	"any":             {2, 2},
+}
+
+// String describes the accepted number of arguments, e.g. "2 or 3 arguments"
+func (a Arity) String() string {
+	unit := "arguments"
+	if a.Max == 1 || a.Max < 0 && a.Min == 1 {
+		unit = "argument"
+	}
+	switch {
+	case a.Max < 0:
+		return fmt.Sprintf("at least %d %s", a.Min, unit)
+	case a.Min == a.Max:
+		return fmt.Sprintf("%d %s", a.Min, unit)
+	case a.Max == a.Min+1:
+		return fmt.Sprintf("%d or %d %s", a.Min, a.Max, unit)
+	default:
+		return fmt.Sprintf("%d to %d %s", a.Min, a.Max, unit)
+	}
+}
+
+// accepts reports whether a function of this arity can be called with n arguments
+func (a Arity) accepts(n int) bool {
+	return n >= a.Min && (a.Max < 0 || n <= a.Max)
+}
+
+// RegisterFunction makes the given function callable by name inside the template.
+func (j *JSONPath) RegisterFunction(name string, fn Function) {
+	if j.functions == nil {
+		j.functions = map[string]Function{}
+	}
+	j.functions[name] = fn
+	delete(j.disabledFunctions, name)
+	delete(j.arities, name)
+}
+
+// RegisterFunctionWithArity registers the function like RegisterFunction. Templates calling
+// it with a number of arguments not accepted by arity fail to parse. It must be called
+// before Parse to take effect.
+func (j *JSONPath) RegisterFunctionWithArity(name string, fn Function, arity Arity) {
+	j.RegisterFunction(name, fn)
+	if j.arities == nil {
+		j.arities = map[string]Arity{}
+	}
+	j.arities[name] = arity
+}
+
+// functionArities returns the arities of all functions checked when parsing. Registered
+// functions replace builtin functions of the same name, including their arity.
+func (j *JSONPath) functionArities() map[string]Arity {
+	arities := map[string]Arity{}
+	for name, arity := range builtinArities {
+		if _, ok := j.functions[name]; !ok && !j.disabledFunctions[name] {
+			arities[name] = arity
+		}
+	}
+	for name, arity := range j.arities {
+		arities[name] = arity
+	}
+	return arities
+}
+
+// UnregisterFunction makes the function with the given name no longer callable inside the
+// template. Builtin functions like sum can be removed as well, e.g. to restrict templates to
+// a known set of functions, until a function of the same name is registered.
+func (j *JSONPath) UnregisterFunction(name string) error {
+	if _, ok := j.functions[name]; ok {
+		delete(j.functions, name)
+		delete(j.arities, name)
+		return nil
+	}
+	if !j.isBuiltinFunction(name) {
+		return fmt.Errorf("function %s is not registered", name)
+	}
+	if j.disabledFunctions == nil {
+		j.disabledFunctions = map[string]bool{}
+	}
+	j.disabledFunctions[name] = true
+	return nil
+}
+
+// RegisteredFunctions returns the sorted names of all functions callable inside the
+// template, both registered and builtin ones.
+func (j *JSONPath) RegisteredFunctions() []string {
+	names := []string{}
+	for name := range j.functions {
+		names = append(names, name)
+	}
+	builtins := []string{}
+	for name := range builtinFunctions {
+		builtins = append(builtins, name)
+	}
+	for name := range quantifiers {
+		builtins = append(builtins, name)
+	}
+	for _, name := range builtins {
+		if _, ok := j.functions[name]; !ok && j.isBuiltinFunction(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isBuiltinFunction reports whether name is a builtin function which was not unregistered
+func (j *JSONPath) isBuiltinFunction(name string) bool {
+	if j.disabledFunctions[name] {
+		return false
+	}
+	_, isQuantifier := quantifiers[name]
+	_, isBuiltin := builtinFunctions[name]
+	return isQuantifier || isBuiltin
+}
+
+// SetUnknownFunctionHandler sets a handler which is called instead of failing
+// when the template calls a function which is not registered.
+func (j *JSONPath) SetUnknownFunctionHandler(fn UnknownFunctionHandler) {
+	j.unknownFunctionHandler = fn
+}
+
+// BindRegexp makes the given regular expression available to the match and search functions
+// under the given name, e.g. {[?(match(@.image, @name))]}.
+// For match, the match the regular expression finds has to span the entire string, so alternatives
+// which are prefixes of each other need a regexp set to Longest, e.g. `a|ab` for "ab".
+func (j *JSONPath) BindRegexp(name string, re *regexp.Regexp) error {
+	if re == nil {
+		return fmt.Errorf("cannot bind a nil regexp to %s", name)
+	}
+	if j.regexps == nil {
+		j.regexps = map[string]*regexp.Regexp{}
+	}
+	j.regexps[name] = re
+	return nil
+}
+
+// matchesEntirely reports whether the match found by the regular expression spans the
+// entire string
+func matchesEntirely(re *regexp.Regexp, s string) bool {
+	loc := re.FindStringIndex(s)
+	return loc != nil && loc[0] == 0 && loc[1] == len(s)
+}
+
+// evalFunction evaluates FunctionNode by calling the function once for every input value
+func (j *JSONPath) evalFunction(input []located, node *FunctionNode) ([]located, error) {
+	results := []located{}
+	if toleratesMissingArgs[node.Name] && j.isBuiltinFunction(node.Name) {
+		// missing keys result in empty arguments, which coalesce skips
+		tolerateMissing := j.tolerateMissing
+		j.tolerateMissing = true
+		defer func() { j.tolerateMissing = tolerateMissing }()
+	}
+	for _, value := range input {
+		args := make([][]reflect.Value, 0, len(node.Args))
+		for _, arg := range node.Args {
+			argResults, err := j.evalList([]located{value}, arg)
+			if err != nil {
+				return input, err
+			}
+			args = append(args, values(argResults))
+		}
+		result, err := j.callFunction(node.Name, args)
+		if err != nil {
+			return input, err
+		}
+		results = append(results, literals(result)...)
+	}
+	return results, nil
+}
+
+// callFunction looks up the function with the given name and calls it
+func (j *JSONPath) callFunction(name string, args [][]reflect.Value) ([]reflect.Value, error) {
+	if fn, ok := j.functions[name]; ok {
+		return fn(args...)
+	}
+	if holds, ok := quantifiers[name]; ok && !j.disabledFunctions[name] {
+		return j.quantify(name, holds, args)
+	}
+	if fn, ok := builtinFunctions[name]; ok && !j.disabledFunctions[name] {
+		return fn(args...)
+	}
+	if j.unknownFunctionHandler != nil {
+		return j.unknownFunctionHandler(name, args...)
+	}
+	return nil, fmt.Errorf("function %s does not exist", name)
+}
+
+// quantify tests the values of the first argument against the filter expression given as
+// second argument. The filter is executed like j, with its options, functions, regular
+// expressions and variables.
+func (j *JSONPath) quantify(name string, holds func(matched, total int) bool, args [][]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("%s expects 2 arguments, got %d", name, len(args))
+	}
+	predicate, ok := singleString(args[1])
+	if !ok {
+		return nil, fmt.Errorf("%s expects a filter expression as second argument", name)
+	}
+	p, err := j.predicates.parse(predicate, func() (*Parser, error) {
+		p := j.newParser(name)
+		return p, p.Parse(fmt.Sprintf("{[?(%s)]}", predicate))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid filter expression %q: %v", name, predicate, err)
+	}
+	filter := j.execution()
+	filter.parser = p
+	// only the values passing the filter are counted
+	filter.each, filter.trace, filter.recorded = nil, nil, nil
+	filter.deduplicate, filter.labelQueries, filter.emitNullForMissing = false, false, false
+	filter.continueOnError, filter.existenceOnly = false, false
+	values := elements(args[0])
+	items := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		items = append(items, value.Interface())
+	}
+	results, err := filter.run(items)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return []reflect.Value{reflect.ValueOf(holds(len(results[0]), len(items)))}, nil
+}
+
+// predicateCache holds the parsed filter expressions of quantifiers, so that each is only
+// parsed once. It is shared by all executions of a template.
+type predicateCache struct {
+	mu      sync.Mutex
+	parsers map[string]*Parser
+}
+
+// parse returns the parser of the predicate, calling parse if it was not parsed before
+func (c *predicateCache) parse(predicate string, parse func() (*Parser, error)) (*Parser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.parsers[predicate]; ok {
+		return p, nil
+	}
+	p, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	c.parsers[predicate] = p
+	return p, nil
+}
+
+// isFunctionCall reports whether the list consists of a single function call
+func isFunctionCall(node *ListNode) bool {
+	return len(node.Nodes) == 1 && node.Nodes[0].Type() == NodeFunction
+}
+
+// isFalseFunctionResult reports whether the list is a function call which returned false,
+// so that it can be used as the test of a filter, e.g. {[?(match(@.name, "a.*"))]}
+func isFalseFunctionResult(node *ListNode, results []reflect.Value) bool {
+	if !isFunctionCall(node) {
+		return false
+	}
+	value, ok := singleValue(results)
+	return ok && value.Kind() == reflect.Bool && !value.Bool()
+}
+
+// singleValue returns the only value of the given function argument, following pointers and interfaces
+func singleValue(arg []reflect.Value) (reflect.Value, bool) {
+	if len(arg) != 1 {
+		return reflect.Value{}, false
+	}
+	value, isNil := template.Indirect(arg[0])
+	if isNil {
+		return reflect.Value{}, false
+	}
+	return value, true
+}
+
+// singleString returns the only value of the given function argument if it is a string
+func singleString(arg []reflect.Value) (string, bool) {
+	value, ok := singleValue(arg)
+	if !ok || value.Kind() != reflect.String {
+		return "", false
+	}
+	return value.String(), true
+}
+
+// elements returns the values of the given function argument, or the elements of its
+// only value if that is an array or slice
+func elements(arg []reflect.Value) []reflect.Value {
+	if len(arg) != 1 {
+		return arg
+	}
+	value, isNil := template.Indirect(arg[0])
+	if isNil || (value.Kind() != reflect.Array && value.Kind() != reflect.Slice) {
+		return arg
+	}
+	result := make([]reflect.Value, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		result = append(result, value.Index(i))
+	}
+	return result
+}
+
+// singleInt returns the only value of the given function argument if it is an integer
+func singleInt(arg []reflect.Value) (int64, bool) {
+	value, ok := singleValue(arg)
+	if !ok {
+		return 0, false
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// larger values would wrap around to negative numbers
+		if value.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(value.Uint()), true
+	}
+	return 0, false
+}
+
+// singleNumber returns the only value of the given function argument as a float64 if it
+// is a number
+func singleNumber(arg []reflect.Value) (float64, bool) {
+	value, ok := singleValue(arg)
+	if !ok {
+		return 0, false
+	}
+	if value.CanInterface() {
+		value = reflect.ValueOf(jsonNumber(value.Interface()))
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// anchorPattern makes the given regular expression match the entire string
+func anchorPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// regexpMatcher returns match, which reports whether the first argument entirely matches
+// the regular expression given by the second argument, or search, which reports whether it
+// contains a match, if not anchored. The regular expression is either a pattern string or
+// a bound regexp. An optional third argument holds flags like in (?flags), e.g.
+// {match(.name, "foo", "i")} or {search(.message, "error", "i")}.
+func regexpMatcher(name string, anchored bool) Function {
+	return func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("%s expects 2 or 3 arguments, got %d", name, len(args))
+		}
+		flags := ""
+		if len(args) == 3 {
+			var ok bool
+			if flags, ok = singleString(args[2]); !ok || !regexpFlagsRex.MatchString(flags) {
+				return nil, fmt.Errorf("%s expects flags of i, m, s and U as third argument", name)
+			}
+		}
+		s, ok := singleString(args[0])
+		if !ok {
+			return []reflect.Value{reflect.ValueOf(false)}, nil
+		}
+		if len(args[1]) == 1 {
+			if re, ok := args[1][0].Interface().(*regexp.Regexp); ok {
+				if flags != "" {
+					return nil, fmt.Errorf("%s cannot apply flags to a bound regexp", name)
+				}
+				if !anchored {
+					return []reflect.Value{reflect.ValueOf(re.MatchString(s))}, nil
+				}
+				return []reflect.Value{reflect.ValueOf(matchesEntirely(re, s))}, nil
+			}
+		}
+		pattern, ok := singleString(args[1])
+		if !ok {
+			return nil, fmt.Errorf("%s expects a regular expression as second argument", name)
+		}
+		expr := pattern
+		if anchored {
+			expr = anchorPattern(pattern)
+		}
+		if flags != "" {
+			expr = "(?" + flags + ")" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+		}
+		return []reflect.Value{reflect.ValueOf(re.MatchString(s))}, nil
+	}
+}
+
+// regexpFlagsRex matches the flags supported by match and search
+var regexpFlagsRex = regexp.MustCompile(`^[imsU]*$`)
+
+// foldASCII lowercases only the ASCII letters A-Z of the string argument, leaving all other
+// runes untouched, so that the result does not depend on unicode case mappings.
+func foldASCII(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("fold_ascii expects 1 argument, got %d", len(args))
+	}
+	s, ok := singleString(args[0])
+	if !ok {
+		return nil, nil
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return []reflect.Value{reflect.ValueOf(string(b))}, nil
+}
+
+// isRegex reports whether its argument is a single string which is a valid regular
+// expression, so that templates can check patterns before passing them to match
+func isRegex(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("is_regex expects 1 argument, got %d", len(args))
+	}
+	s, ok := singleString(args[0])
+	if !ok {
+		return []reflect.Value{reflect.ValueOf(false)}, nil
+	}
+	_, err := regexp.Compile(s)
+	return []reflect.Value{reflect.ValueOf(err == nil)}, nil
+}
+
+// stringTransform returns a function transforming a single string, other arguments have no result
+func stringTransform(name string, fn func(string) string) Function {
+	return func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		}
+		s, ok := singleString(args[0])
+		if !ok {
+			return nil, nil
+		}
+		return []reflect.Value{reflect.ValueOf(fn(s))}, nil
+	}
+}
+
+// base64Encode returns the standard base64 encoding of the string
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// base64Decode decodes a single standard base64 encoded string, other arguments have no result
+func base64Decode(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("b64dec expects 1 argument, got %d", len(args))
+	}
+	s, ok := singleString(args[0])
+	if !ok {
+		return nil, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("b64dec: %v", err)
+	}
+	return []reflect.Value{reflect.ValueOf(string(b))}, nil
+}
+
+// split returns the parts of the first argument separated by the second argument,
+// e.g. {split(.csv, ",")}. An empty string has no parts.
+func split(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("split expects 2 arguments, got %d", len(args))
+	}
+	sep, ok := singleString(args[1])
+	if !ok {
+		return nil, fmt.Errorf("split expects a string as second argument")
+	}
+	s, ok := singleString(args[0])
+	if !ok || s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, sep)
+	results := make([]reflect.Value, 0, len(parts))
+	for _, part := range parts {
+		results = append(results, reflect.ValueOf(part))
+	}
+	return results, nil
+}
+
+// join returns the values of the first argument, printed as by PrintResults and
+// separated by the second argument, e.g. {join(.items[*].name, ", ")}
+func join(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("join expects 2 arguments, got %d", len(args))
+	}
+	sep, ok := singleString(args[1])
+	if !ok {
+		return nil, fmt.Errorf("join expects a string as second argument")
+	}
+	parts := []string{}
+	for _, value := range elements(args[0]) {
+		text, err := printValue(value)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, text)
+	}
+	return []reflect.Value{reflect.ValueOf(strings.Join(parts, sep))}, nil
+}
+
+// valueOf returns the value of its argument if it has exactly one, following pointers and
+// interfaces, and no value otherwise, e.g. {value(.spec.ports[*].port)}
+func valueOf(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("value expects 1 argument, got %d", len(args))
+	}
+	value, ok := singleValue(args[0])
+	if !ok {
+		return nil, nil
+	}
+	return []reflect.Value{value}, nil
+}
+
+// first returns the first value of its argument, e.g. {first(.items[*]).name}
+func first(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("first expects 1 argument, got %d", len(args))
+	}
+	values := elements(args[0])
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[:1], nil
+}
+
+// last returns the last value of its argument, e.g. {last(.items[*]).name}
+func last(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("last expects 1 argument, got %d", len(args))
+	}
+	values := elements(args[0])
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[len(values)-1:], nil
+}
+
+// window returns at most count values of the first argument, skipping offset values,
+// e.g. {window(.items[*], 10, 5)}
+func window(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("window expects 3 arguments, got %d", len(args))
+	}
+	offset, ok := singleInt(args[1])
+	if !ok || offset < 0 {
+		return nil, fmt.Errorf("window expects a non-negative integer offset")
+	}
+	count, ok := singleInt(args[2])
+	if !ok || count < 0 {
+		return nil, fmt.Errorf("window expects a non-negative integer count")
+	}
+	values := elements(args[0])
+	if offset >= int64(len(values)) {
+		return nil, nil
+	}
+	values = values[offset:]
+	if count < int64(len(values)) {
+		values = values[:count]
+	}
+	return values, nil
+}
+
+// printValue returns the text of a single value as printed by PrintResults without
+// formatting options: containers as JSON and everything else as text
+func printValue(value reflect.Value) (string, error) {
+	if text, ok, err := textValue(value, false); ok || err != nil {
+		return text, err
+	}
+	kind := value.Kind()
+	if kind == reflect.Interface {
+		kind = value.Elem().Kind()
+	}
+	switch kind {
+	case reflect.Map, reflect.Array, reflect.Slice, reflect.Struct:
+		text, err := json.Marshal(value.Interface())
+		return string(text), err
+	}
+	iface, ok := template.PrintableValue(value)
+	if !ok {
+		return "", fmt.Errorf("can't print type %s", value.Type())
+	}
+	return fmt.Sprint(iface), nil
+}
+
+// jsonType returns the JSON type of the given value: string, number, boolean, null, array or object
+func jsonType(value reflect.Value) string {
+	value, isNil := template.Indirect(value)
+	if isNil || !value.IsValid() {
+		return "null"
+	}
+	if value.Type() == reflect.TypeOf(json.Number("")) {
+		return "number"
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Array, reflect.Slice:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return value.Kind().String()
+}
+
+// typeOf returns the JSON type of its argument, e.g. {[?(type(@.value)=="number")]}
+func typeOf(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("type expects 1 argument, got %d", len(args))
+	}
+	if len(args[0]) != 1 {
+		return nil, nil
+	}
+	return []reflect.Value{reflect.ValueOf(jsonType(args[0][0]))}, nil
+}
+
+// coalesce returns the first argument which is a single non-null, non-empty value,
+// or the last argument if there is none, e.g. {coalesce(.status.hostIP, "unknown")}
+func coalesce(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("coalesce expects at least 1 argument")
+	}
+	for _, arg := range args {
+		value, ok := singleValue(arg)
+		if !ok || (value.Kind() == reflect.String && value.Len() == 0) {
+			continue
+		}
+		return arg, nil
+	}
+	return args[len(args)-1], nil
+}
+
+// sum returns the total of the numbers of its argument, e.g. {sum(.items[*].spec.replicas)}.
+// The total is an int64 if all numbers are integers and a float64 otherwise.
+func sum(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("sum expects 1 argument, got %d", len(args))
+	}
+	var intTotal int64
+	var floatTotal float64
+	isFloat := false
+	for _, arg := range elements(args[0]) {
+		value, isNil := template.Indirect(arg)
+		if isNil {
+			return nil, fmt.Errorf("sum expects numbers, got nil")
+		}
+		if value.CanInterface() {
+			value = reflect.ValueOf(jsonNumber(value.Interface()))
+		}
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			intTotal += value.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			intTotal += int64(value.Uint())
+		case reflect.Float32, reflect.Float64:
+			floatTotal += value.Float()
+			isFloat = true
+		default:
+			return nil, fmt.Errorf("sum expects numbers, got %v", value.Interface())
+		}
+	}
+	if isFloat {
+		return []reflect.Value{reflect.ValueOf(floatTotal + float64(intTotal))}, nil
+	}
+	return []reflect.Value{reflect.ValueOf(intTotal)}, nil
+}
+
+// avg returns the mean of the numbers of its argument as a float64, e.g.
+// {.nums[?(@ > avg($.nums[*]))]} selects the numbers above the average. There is no
+// result if there are no numbers.
+func avg(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("avg expects 1 argument, got %d", len(args))
+	}
+	values := elements(args[0])
+	if len(values) == 0 {
+		return nil, nil
+	}
+	var total float64
+	for _, arg := range values {
+		value, isNil := template.Indirect(arg)
+		if isNil {
+			return nil, fmt.Errorf("avg expects numbers, got nil")
+		}
+		n, ok := singleNumber([]reflect.Value{value})
+		if !ok {
+			return nil, fmt.Errorf("avg expects numbers, got %v", value.Interface())
+		}
+		total += n
+	}
+	return []reflect.Value{reflect.ValueOf(total / float64(len(values)))}, nil
+}
+
+// distinct returns a function returning the values of its argument without duplicates,
+// keeping the first occurrence of each, e.g. {unique(.books[*].author)}. Values are
+// compared deeply, so equal objects are duplicates as well.
+func distinct(name string) Function {
+	return func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		}
+		result := []reflect.Value{}
+		seen := []interface{}{}
+		for _, value := range elements(args[0]) {
+			v := value.Interface()
+			if !containsEqual(seen, v) {
+				seen = append(seen, v)
+				result = append(result, value)
+			}
+		}
+		return result, nil
+	}
+}
+
+// containsEqual reports whether one of the values is deeply equal to v
+func containsEqual(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// minValue returns the smallest value of its argument, ordered like in filter comparisons
+// except that numbers of different types compare by value
+func minValue(args ...[]reflect.Value) ([]reflect.Value, error) {
+	return extremeValue("min", func(value, result reflect.Value) (bool, error) {
+		return lessValue(value, result)
+	}, args)
+}
+
+// maxValue returns the largest value of its argument, ordered like in filter comparisons
+// except that numbers of different types compare by value
+func maxValue(args ...[]reflect.Value) ([]reflect.Value, error) {
+	return extremeValue("max", func(value, result reflect.Value) (bool, error) {
+		return lessValue(result, value)
+	}, args)
+}
+
+// extremeValue returns the element of the argument for which better holds against all
+// others, the first one of equal elements, or no value if the argument is empty
+func extremeValue(name string, better func(value, result reflect.Value) (bool, error), args [][]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+	}
+	var result reflect.Value
+	for _, value := range elements(args[0]) {
+		if !result.IsValid() {
+			result = value
+			continue
+		}
+		isBetter, err := better(value, result)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if isBetter {
+			result = value
+		}
+	}
+	if !result.IsValid() {
+		return nil, nil
+	}
+	return []reflect.Value{result}, nil
+}
+
+// lessValue reports whether a is less than b, comparing numbers of any type by value and
+// other values like in filter comparisons, e.g. strings lexically
+func lessValue(a, b reflect.Value) (bool, error) {
+	if x, ok := singleNumber([]reflect.Value{a}); ok {
+		if y, ok := singleNumber([]reflect.Value{b}); ok {
+			return x < y, nil
+		}
+	}
+	return template.Less(a.Interface(), b.Interface())
+}
+
+// sortValues returns the values of its argument in ascending order, ordered like in
+// filter comparisons and by min and max, e.g. {sort(.items[*].metadata.name)}. Numbers of
+// any type are ordered by value.
+func sortValues(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("sort expects 1 argument, got %d", len(args))
+	}
+	values := append([]reflect.Value{}, elements(args[0])...)
+	var err error
+	sort.SliceStable(values, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		var less bool
+		less, err = lessValue(values[i], values[j])
+		return less
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sort: %v", err)
+	}
+	return values, nil
+}
+
+// keys returns the keys of a map, in sorted order, or the JSON names of the exported fields
+// of a struct, e.g. {keys(.metadata.labels)}. Other values have no keys.
+func keys(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("keys expects 1 argument, got %d", len(args))
+	}
+	value, ok := singleValue(args[0])
+	if !ok {
+		return nil, nil
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		return sortedMapKeys(value), nil
+	case reflect.Struct:
+		result := []reflect.Value{}
+		for _, name := range structKeys(value, map[string]bool{}) {
+			result = append(result, reflect.ValueOf(name))
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+// structKeys returns the names by which the fields of a struct are found, like in
+// findFieldInValue: fields tagged json:"-" are left out, and the fields of inline and
+// embedded structs are listed in place of the struct itself unless they are nil.
+// Names already seen are skipped.
+func structKeys(value reflect.Value, seen map[string]bool) []string {
+	result := []string{}
+	for i := 0; i < value.NumField(); i++ {
+		f := value.Type().Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			// inline and embedded structs, skipping nil pointers
+			if field, isNil := template.Indirect(value.Field(i)); !isNil && field.Kind() == reflect.Struct {
+				result = append(result, structKeys(field, seen)...)
+			}
+			if f.Anonymous {
+				continue
+			}
+			name = f.Name
+		}
+		if !f.IsExported() || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// divisibleBy reports whether the first integer argument is divisible by the second,
+// e.g. {[?(divisible_by(@index, 2))]} selects the elements with even indexes
+func divisibleBy(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("divisible_by expects 2 arguments, got %d", len(args))
+	}
+	a, ok := singleInt(args[0])
+	if !ok {
+		return nil, fmt.Errorf("divisible_by expects an integer as first argument")
+	}
+	b, ok := singleInt(args[1])
+	if !ok {
+		return nil, fmt.Errorf("divisible_by expects an integer as second argument")
+	}
+	if b == 0 {
+		return nil, fmt.Errorf("divisible_by: division by zero")
+	}
+	return []reflect.Value{reflect.ValueOf(a%b == 0)}, nil
+}
+
+// percent returns the first numeric argument as a percentage of the second, e.g.
+// {[?(percent(@.used, @.total) > 90.0)]}. There is no result if the second is 0.
+func percent(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("percent expects 2 arguments, got %d", len(args))
+	}
+	part, ok := singleNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("percent expects a number as first argument")
+	}
+	total, ok := singleNumber(args[1])
+	if !ok {
+		return nil, fmt.Errorf("percent expects a number as second argument")
+	}
+	if total == 0 {
+		return nil, nil
+	}
+	return []reflect.Value{reflect.ValueOf(100 * part / total)}, nil
+}
+
+// ageClock returns the current time for age, tests replace it with a fixed clock
+var ageClock = time.Now
+
+// age returns the seconds elapsed since the RFC 3339 timestamp given as argument, e.g.
+// {[?(age(@.metadata.creationTimestamp) > 3600.0)]}. There is no result if the argument
+// is not such a timestamp.
+func age(args ...[]reflect.Value) ([]reflect.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("age expects 1 argument, got %d", len(args))
+	}
+	s, ok := singleString(args[0])
+	if !ok {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, nil
+	}
+	return []reflect.Value{reflect.ValueOf(ageClock().Sub(t).Seconds())}, nil
+}
+
+// numeric returns a function transforming a single number, integers are transformed by
+// onInt and floating point numbers by onFloat. A json.Number is transformed like the
+// integer or floating point number it holds. Other arguments have no result.
+func numeric(name string, onInt func(int64) int64, onFloat func(float64) float64) Function {
+	return func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		}
+		value, ok := singleValue(args[0])
+		if !ok {
+			return nil, nil
+		}
+		if value.CanInterface() {
+			value = reflect.ValueOf(jsonNumber(value.Interface()))
+		}
+		arg := []reflect.Value{value}
+		if i, ok := singleInt(arg); ok {
+			return []reflect.Value{reflect.ValueOf(onInt(i))}, nil
+		}
+		if f, ok := singleNumber(arg); ok {
+			return []reflect.Value{reflect.ValueOf(onFloat(f))}, nil
+		}
+		return nil, nil
+	}
+}
+
+// absInt returns the absolute value of an integer
+func absInt(i int64) int64 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// identityInt returns the integer, which is already rounded
+func identityInt(i int64) int64 {
+	return i
+}
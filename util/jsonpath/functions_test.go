@@ -0,0 +1,1080 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var functionTestData = map[string]interface{}{
+	"name":  "pod1",
+	"items": []interface{}{"a", "b", "c"},
+	"containers": []interface{}{
+		map[string]interface{}{"name": "foo", "image": "nginx"},
+		map[string]interface{}{"name": "bar", "image": "busybox"},
+	},
+}
+
+func TestRegisterFunction(t *testing.T) {
+	count := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("count expects 1 argument, got %d", len(args))
+		}
+		return []reflect.Value{reflect.ValueOf(len(args[0]))}, nil
+	}
+	tests := []jsonpathTest{
+		{"count", `{count(.items[*])}`, functionTestData, "3", false},
+		{"count in text", `items: {count(.items[*])}`, functionTestData, "items: 3", false},
+		{"count in filter", `{.containers[?(count(@.*)==2)].name}`, functionTestData, "foo bar", false},
+		{"count with wrong arity", `{count(.items[*], .name)}`, functionTestData, "", true},
+		{"not registered", `{length(.items[*])}`, functionTestData, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.RegisterFunction("count", count) }, t)
+}
+
+func TestUnknownFunctionHandler(t *testing.T) {
+	handler := func(name string, args ...[]reflect.Value) ([]reflect.Value, error) {
+		if !strings.HasPrefix(name, "x_") {
+			return nil, fmt.Errorf("function %s does not exist", name)
+		}
+		parts := []string{strings.TrimPrefix(name, "x_")}
+		for _, arg := range args {
+			for _, value := range arg {
+				parts = append(parts, fmt.Sprint(value.Interface()))
+			}
+		}
+		return []reflect.Value{reflect.ValueOf(strings.Join(parts, "-"))}, nil
+	}
+	upper := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		return []reflect.Value{reflect.ValueOf(strings.ToUpper(fmt.Sprint(args[0][0].Interface())))}, nil
+	}
+	tests := []jsonpathTest{
+		{"arbitrary function", `{x_dashed(.name, .items[*])}`, functionTestData, "dashed-pod1-a-b-c", false},
+		{"arbitrary function in filter", `{.containers[?(x_img(@.image)=="img-nginx")].name}`, functionTestData, "foo", false},
+		{"registered function first", `{upper(.name)}`, functionTestData, "POD1", false},
+		{"handler rejects function", `{y_dashed(.name)}`, functionTestData, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.RegisterFunction("upper", upper)
+		j.SetUnknownFunctionHandler(handler)
+	}, t)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []jsonpathTest{
+		{"match pattern", `{match(.name, "pod[0-9]")}`, functionTestData, "true", false},
+		{"match pattern partially", `{match(.name, "pod")}`, functionTestData, "false", false},
+		{"match non-string", `{match(.items, "a")}`, functionTestData, "false", false},
+		{"match in filter", `{.containers[?(match(@.image, "busy.*"))].name}`, functionTestData, "bar", false},
+		{"match compared in filter", `{.containers[?(match(@.image, "busy.*")==false)].name}`, functionTestData, "foo", false},
+		{"match invalid pattern", `{match(.name, "pod[")}`, functionTestData, "", true},
+		{"match wrong arity", `{match(.name)}`, functionTestData, "", true},
+		{"match case sensitive", `{match(.name, "POD1")}`, functionTestData, "false", false},
+		{"match case insensitive", `{match(.name, "POD1", "i")}`, functionTestData, "true", false},
+		{"match flags in filter", `{.containers[?(match(@.image, "NGINX", "i"))].name}`, functionTestData, "foo", false},
+		{"match several flags", `{match(.multiline, "a.b", "si")}`, map[string]interface{}{"multiline": "A\nb"}, "true", false},
+		{"match empty flags", `{match(.name, "pod1", "")}`, functionTestData, "true", false},
+		{"match unknown flag", `{match(.name, "pod1", "x")}`, functionTestData, "", true},
+		{"match wrong arity with flags", `{match(.name, "a", "i", "m")}`, functionTestData, "", true},
+	}
+	testJSONPathWithSetup(tests, nil, t)
+}
+
+func TestSearch(t *testing.T) {
+	tests := []jsonpathTest{
+		{"search part", `{search(.name, "od")}`, functionTestData, "true", false},
+		{"search no match", `{search(.name, "x")}`, functionTestData, "false", false},
+		{"search anchored pattern", `{search(.name, "^od")}`, functionTestData, "false", false},
+		{"search case sensitive", `{search(.name, "POD")}`, functionTestData, "false", false},
+		{"search case insensitive", `{search(.name, "POD", "i")}`, functionTestData, "true", false},
+		{"search in filter", `{.containers[?(search(@.image, "BOX", "i"))].name}`, functionTestData, "bar", false},
+		{"search bound regexp", `{.containers[?(search(@.image, @gin))].name}`, functionTestData, "foo", false},
+		{"search flags for bound regexp", `{search(.name, @gin, "i")}`, functionTestData, "", true},
+		{"search non-string", `{search(.items, "a")}`, functionTestData, "false", false},
+		{"search unknown flag", `{search(.name, "pod", "x")}`, functionTestData, "", true},
+		{"search invalid pattern", `{search(.name, "pod[")}`, functionTestData, "", true},
+		{"search wrong arity", `{search(.name)}`, functionTestData, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		if err := j.BindRegexp("gin", regexp.MustCompile(`gin`)); err != nil {
+			t.Fatal(err)
+		}
+	}, t)
+}
+
+func TestBindRegexp(t *testing.T) {
+	tests := []jsonpathTest{
+		{"match bound regexp", `{.containers[?(match(@.image, @nginxish))].name}`, functionTestData, "foo", false},
+		{"match bound regexp without @", `{.containers[?(match(@.image, nginxish))].name}`, functionTestData, "foo", false},
+		{"match bound regexp entirely", `{.containers[?(match(@.image, @busy))].name}`, functionTestData, "", false},
+		{"match bound regexp at top level", `{match(.name, @nginxish)}`, functionTestData, "false", false},
+		{"unbound regexp", `{.containers[?(match(@.image, @unbound))].name}`, functionTestData, "", true},
+		{"flags for bound regexp", `{match(.name, @busy, "i")}`, functionTestData, "", true},
+		{"leftmost first alternatives", `{.containers[?(match(@.image, @prefixed))].name}`, functionTestData, "", false},
+		{"longest alternatives", `{.containers[?(match(@.image, @longest))].name}`, functionTestData, "bar", false},
+	}
+	longest := regexp.MustCompile(`busy|busybox`)
+	longest.Longest()
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		for name, re := range map[string]*regexp.Regexp{
+			"nginxish": regexp.MustCompile(`(?i)NG[a-z]+`),
+			"busy":     regexp.MustCompile(`busy`),
+			"prefixed": regexp.MustCompile(`busy|busybox`),
+			"longest":  longest,
+		} {
+			if err := j.BindRegexp(name, re); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}, t)
+
+	if err := New("nil").BindRegexp("none", nil); err == nil {
+		t.Error("expect binding a nil regexp to fail")
+	}
+}
+
+func TestFoldASCII(t *testing.T) {
+	data := map[string]interface{}{
+		"mixed":   "Kube-Proxy",
+		"turkish": "İSTANBUL",
+		"number":  5,
+		"labels": []interface{}{
+			map[string]interface{}{"key": "APP", "value": "web"},
+			map[string]interface{}{"key": "App", "value": "db"},
+			map[string]interface{}{"key": "İapp", "value": "cache"},
+		},
+	}
+	tests := []jsonpathTest{
+		{"mixed case", `{fold_ascii(.mixed)}`, data, "kube-proxy", false},
+		{"non ascii untouched", `{fold_ascii(.turkish)}`, data, "İstanbul", false},
+		{"non string", `{fold_ascii(.number)}`, data, "", false},
+		{"in filter", `{.labels[?(fold_ascii(@.key)=="app")].value}`, data, "web db", false},
+		{"turkish i is not folded", `{.labels[?(fold_ascii(@.key)=="iapp")].value}`, data, "", false},
+		{"wrong arity", `{fold_ascii(.mixed, .turkish)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestIsRegex(t *testing.T) {
+	data := map[string]interface{}{
+		"valid":   "^kube-.*$",
+		"invalid": "kube-(proxy",
+		"empty":   "",
+		"number":  5.0,
+		"rules": []interface{}{
+			map[string]interface{}{"name": "proxy", "pattern": "kube-pro.y"},
+			map[string]interface{}{"name": "broken", "pattern": "[a-"},
+			map[string]interface{}{"name": "any", "pattern": ".*"},
+			map[string]interface{}{"name": "repeat", "pattern": "a**"},
+		},
+	}
+	tests := []jsonpathTest{
+		{"valid", `{is_regex(.valid)}`, data, "true", false},
+		{"invalid", `{is_regex(.invalid)}`, data, "false", false},
+		{"empty", `{is_regex(.empty)}`, data, "true", false},
+		{"literal", `{is_regex("(a|b)+")}`, data, "true", false},
+		{"non string", `{is_regex(.number)}`, data, "false", false},
+		{"several strings", `{is_regex(.rules[*].pattern)}`, data, "false", false},
+		{"missing", `{is_regex(.missing)}`, data, "false", false},
+		{"in filter", `{.rules[?(is_regex(@.pattern))].name}`, data, "proxy any", false},
+		{"guarding match", `{range .rules[?(is_regex(@.pattern))]}{.name}={match("kube-proxy", @.pattern)} {end}`, data,
+			"proxy=true any=true ", false},
+		{"wrong arity", `{is_regex(.valid, .invalid)}`, data, "", true},
+	}
+	testJSONPath(tests, true, t)
+}
+
+func TestType(t *testing.T) {
+	data := map[string]interface{}{
+		"interfaces": []interface{}{true, "one", 1, 1.1, nil, map[string]interface{}{"a": 1}, []int{1, 2}},
+	}
+	tests := []jsonpathTest{
+		{"types", `{range .interfaces[*]}{type(@)} {end}`, data, "boolean string number number null object array ", false},
+		{"in filter", `{.interfaces[?(type(@)=="number")]}`, data, "1 1.1", false},
+		{"missing value", `{type(.missing)}`, data, "", false},
+		{"struct", `{type(@)}`, book{Author: "a"}, "object", false},
+		{"pointer", `{type(@)}`, &book{Author: "a"}, "object", false},
+		{"nil pointer", `{type(.Previous)}`, release{}, "null", false},
+		{"array", `{type(@)}`, [2]string{"a", "b"}, "array", false},
+		{"field of struct", `{type(.Price)}`, book{Price: 1}, "number", false},
+		{"wrong arity", `{type()}`, data, "", true},
+	}
+	testJSONPath(tests, true, t)
+}
+
+func TestCoalesce(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "status": map[string]interface{}{"podIP": "10.0.0.1"}},
+			map[string]interface{}{"name": "pod2", "status": map[string]interface{}{"hostIP": "192.168.0.1", "podIP": "10.0.0.2"}},
+			map[string]interface{}{"name": "pod3", "status": map[string]interface{}{"hostIP": ""}},
+		},
+	}
+	tests := []jsonpathTest{
+		{"first absent", `{coalesce(.items[0].status.hostIP, .items[0].status.podIP, "unknown")}`, data, "10.0.0.1", false},
+		{"first present", `{coalesce(.items[1].status.hostIP, .items[1].status.podIP, "unknown")}`, data, "192.168.0.1", false},
+		{"fallback", `{coalesce(.items[2].status.hostIP, .items[2].status.podIP, "unknown")}`, data, "unknown", false},
+		{"range", `{range .items[*]}{.name}={coalesce(.status.hostIP, .status.podIP, "unknown")} {end}`, data,
+			"pod1=10.0.0.1 pod2=192.168.0.1 pod3=unknown ", false},
+		{"no arguments", `{coalesce()}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestSum(t *testing.T) {
+	data := map[string]interface{}{
+		"integers": []int{1, 2, 3, 4},
+		"floats":   []float64{1.5, 2.25},
+		"mixed":    []interface{}{1, 2.5, uint8(3)},
+		"strings":  []string{"one"},
+		"empty":    []int{},
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "spec": map[string]interface{}{"replicas": 2, "ports": []int{1, 2}}},
+			map[string]interface{}{"name": "b", "spec": map[string]interface{}{"replicas": 3, "ports": []int{3}}},
+		},
+	}
+	tests := []jsonpathTest{
+		{"integers", `{sum(.integers)}`, data, "10", false},
+		{"integer results", `{sum(.integers[*])}`, data, "10", false},
+		{"floats", `{sum(.floats)}`, data, "3.75", false},
+		{"mixed", `{sum(.mixed)}`, data, "6.5", false},
+		{"empty", `{sum(.empty)}`, data, "0", false},
+		{"fields", `{sum(.items[*].spec.replicas)}`, data, "5", false},
+		{"per item", `{range .items[*]}{.name}={sum(.spec.ports)} {end}`, data, "a=3 b=3 ", false},
+		{"in filter", `{.items[?(sum(@.spec.ports)>2)].name}`, data, "a b", false},
+		{"non numeric", `{sum(.strings)}`, data, "", true},
+		{"wrong arity", `{sum(.integers, .floats)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestDistinctValues(t *testing.T) {
+	storeData := store{
+		Book: []book{
+			{"reference", "Nigel Rees", "Sayings of the Century", 8.95},
+			{"fiction", "Evelyn Waugh", "Sword of Honour", 12.99},
+			{"fiction", "Herman Melville", "Moby Dick", 8.99},
+			{"fiction", "Evelyn Waugh", "Brideshead Revisited", 8.99},
+		},
+		Bicycle: []bicycle{
+			{"red", 19.95, true},
+			{"red", 19.95, true},
+			{"green", 20.01, false},
+		},
+	}
+	tests := []jsonpathTest{
+		{"categories", `{distinct_values(.Book[*].Category)}`, storeData, "reference fiction", false},
+		{"authors", `{distinct_values(.Book[*].Author)}`, storeData, "Nigel Rees Evelyn Waugh Herman Melville", false},
+		{"prices", `{distinct_values(.Book[*].Price)}`, storeData, "8.95 12.99 8.99", false},
+		{"deep equal objects", `{distinct_values(.Bicycle)}`, storeData,
+			`{"Color":"red","Price":19.95,"IsNew":true} {"Color":"green","Price":20.01,"IsNew":false}`, false},
+		{"empty", `{distinct_values(.Book[?(@.Price>100.0)].Author)}`, storeData, "", false},
+		{"wrong arity", `{distinct_values()}`, storeData, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestMinMax(t *testing.T) {
+	data := map[string]interface{}{
+		"integers": []int{3, 1, 4, 1, 5},
+		"floats":   []float64{2.5, -1.25, 0},
+		"strings":  []string{"pear", "apple", "zucchini"},
+		"mixed":    []interface{}{1, "one"},
+		"empty":    []int{},
+		"single":   []int{42},
+		"word":     []string{"only"},
+		"numbers":  []interface{}{3, 7.5, int8(-2), uint(4), float32(0.5)},
+		"names":    []string{"alice", "bob", "bob", "ann"},
+		"versions": []string{"9", "10", "2"},
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "replicas": 2},
+			map[string]interface{}{"name": "b", "replicas": 7},
+		},
+		"tied": []interface{}{
+			map[string]interface{}{"name": "x", "replicas": 3},
+			map[string]interface{}{"name": "y", "replicas": 1},
+			map[string]interface{}{"name": "z", "replicas": 3},
+		},
+	}
+	tests := []jsonpathTest{
+		{"min integers", `{min(.integers)}`, data, "1", false},
+		{"max integers", `{max(.integers)}`, data, "5", false},
+		{"min floats", `{min(.floats)}`, data, "-1.25", false},
+		{"max floats", `{max(.floats)}`, data, "2.5", false},
+		{"min strings", `{min(.strings)}`, data, "apple", false},
+		{"max strings", `{max(.strings)}`, data, "zucchini", false},
+		{"max fields", `{max(.items[*].replicas)}`, data, "7", false},
+		{"in filter", `{.items[?(@.replicas==max($.items[*].replicas))].name}`, data, "b", false},
+		{"min empty", `{min(.empty)}`, data, "", false},
+		{"max empty", `{max(.empty)}`, data, "", false},
+		{"incomparable", `{min(.mixed)}`, data, "", true},
+		{"wrong arity", `{max(.integers, .floats)}`, data, "", true},
+		{"single integer", `{min(.single)}`, data, "42", false},
+		{"single string", `{max(.word)}`, data, "only", false},
+		{"min mixed numbers", `{min(.numbers)}`, data, "-2", false},
+		{"max mixed numbers", `{max(.numbers)}`, data, "7.5", false},
+		{"string ties", `{max(.names)}`, data, "bob", false},
+		{"lexical order", `{min(.versions)}`, data, "10", false},
+		{"max string fields", `{max(.items[*].name)}`, data, "b", false},
+		{"min in filter", `{.items[?(@.replicas==min($.items[*].replicas))].name}`, data, "a", false},
+		{"ties in filter", `{.tied[?(@.replicas==max($.tied[*].replicas))].name}`, data, "x z", false},
+	}
+	testJSONPath(tests, false, t)
+
+	// of equal elements the first one is returned
+	ties := []reflect.Value{reflect.ValueOf([]interface{}{int8(2), 2.0, uint(1), float32(1)})}
+	minimum, err := minValue(ties)
+	if err != nil || len(minimum) != 1 || minimum[0].Elem().Type() != reflect.TypeOf(uint(0)) {
+		t.Errorf("expect min to return the uint, got %v and error %v", minimum, err)
+	}
+	maximum, err := maxValue(ties)
+	if err != nil || len(maximum) != 1 || maximum[0].Elem().Type() != reflect.TypeOf(int8(0)) {
+		t.Errorf("expect max to return the int8, got %v and error %v", maximum, err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	pod := taggedPod{typeMeta: typeMeta{Kind: "Pod"}, Meta: objectMeta{Name: "pod1"}}
+	data := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app": "web", "tier": "frontend", "env": "prod"},
+		},
+		"pod":    pod,
+		"owned":  taggedPod{ownerInfo: &ownerInfo{Owner: "team"}},
+		"ports":  []int{80},
+		"string": "text",
+		"empty":  map[string]interface{}{},
+	}
+	tests := []jsonpathTest{
+		{"map", `{keys(.metadata.labels)}`, data, "app env tier", false},
+		{"struct honors json tags", `{keys(.pod.metadata)}`, data, "name displayName labels", false},
+		{"struct with inline and ignored fields", `{keys(.pod)}`, data, "kind metadata Generation", false},
+		{"struct with embedded struct", `{keys(.owned)}`, data, "kind owner metadata Generation", false},
+		{"empty map", `{keys(.empty)}`, data, "", false},
+		{"array", `{keys(.ports)}`, data, "", false},
+		{"string", `{keys(.string)}`, data, "", false},
+		{"wrong arity", `{keys()}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestDivisibleBy(t *testing.T) {
+	data := map[string]interface{}{
+		"letters": []string{"a", "b", "c", "d", "e"},
+		"numbers": []int{3, 4, 9, 10},
+		"floats":  []float64{1.5},
+		"huge":    uint64(math.MaxUint64),
+	}
+	tests := []jsonpathTest{
+		{"even indexes", `{.letters[?(divisible_by(@index, 2))]}`, data, "a c e", false},
+		{"every third", `{.letters[?(divisible_by(@index, 3))]}`, data, "a d", false},
+		{"values", `{.numbers[?(divisible_by(@, 3))]}`, data, "3 9", false},
+		{"literals", `{divisible_by(10, 5)}`, data, "true", false},
+		{"negative", `{divisible_by(-9, 3)}`, data, "true", false},
+		{"zero divisor", `{.letters[?(divisible_by(@index, 0))]}`, data, "", true},
+		{"non integer", `{.floats[?(divisible_by(@, 2))]}`, data, "", true},
+		{"unsigned beyond int64", `{divisible_by(.huge, 3)}`, data, "", true},
+		{"wrong arity", `{divisible_by(10)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestPipe(t *testing.T) {
+	number := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		results := []reflect.Value{}
+		for _, value := range args[0] {
+			f, err := strconv.ParseFloat(fmt.Sprint(value.Interface()), 64)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, reflect.ValueOf(f))
+		}
+		return results, nil
+	}
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"cpu": "1.5"},
+			map[string]interface{}{"cpu": "2"},
+			map[string]interface{}{"cpu": "1.5"},
+		},
+	}
+	tests := []jsonpathTest{
+		{"single function", `{.items[*].cpu | number}`, data, "1.5 2 1.5", false},
+		{"two functions", `{.items[*].cpu | number | sum}`, data, "5", false},
+		{"three functions", `{.items[*].cpu|distinct_values|number|sum}`, data, "3.5", false},
+		{"pipe in text", `total: {.items[*].cpu | number | sum}`, data, "total: 5", false},
+		{"pipe to unknown function", `{.items[*].cpu | length}`, data, "", true},
+		{"quoted field containing a pipe", `{['a|b']}`, map[string]interface{}{"a|b": "x"}, "x", false},
+		{"quoted key with escaped dot and pipe", `{.ann['x\.y|z']}`, map[string]interface{}{"ann": map[string]interface{}{"x.y|z": "x"}}, "x", false},
+		{"quoted path containing a pipe", `{['a.b|c']}`, map[string]interface{}{"a": map[string]interface{}{"b|c": "x"}}, "x", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.RegisterFunction("number", number) }, t)
+}
+
+func TestLet(t *testing.T) {
+	count := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		return []reflect.Value{reflect.ValueOf(len(args[0]))}, nil
+	}
+	data := map[string]interface{}{
+		"limit": 2.0,
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "size": 1.0},
+			map[string]interface{}{"name": "b", "size": 3.0},
+			map[string]interface{}{"name": "c", "size": 2.0},
+		},
+	}
+	tests := []jsonpathTest{
+		{"bind a count", `{let total := count(.items[*])}total is {$total}`, data, "total is 3", false},
+		{"bind a query", `{let limit := .limit}{.items[?(@.size > $limit)].name}`, data, "b", false},
+		{"bind several results", `{let names := .items[*].name}{$names}`, data, `["a","b","c"]`, false},
+		{"bind a pipe", `{let total := .items[*].size | sum}{$total}`, data, "6", false},
+		{"bind within range", `{range .items[*]}{let n := .name}{$n};{end}`, data, "a;b;c;", false},
+		{"not bound after range", `{range .items[*]}{let n := .name}{end}{$n}`, data, "", true},
+		{"bound before range", `{let n := .limit}{range .items[*]}{let n := .name}{end}{$n}`, data, "2", false},
+		{"not bound in next iteration", `{range .items[*]}{$n}{let n := .name}{end}`, data, "", true},
+		{"rebind", `{let x := .limit}{let x := count(.items[*])}{$x}`, data, "3", false},
+		{"not yet bound", `{$total}{let total := count(.items[*])}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.RegisterFunction("count", count) }, t)
+
+	j := New("let")
+	j.RegisterFunction("count", count)
+	if err := j.Parse(`{let total := count(.items[*])}{$total}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.FindResults(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.variables["total"]; ok {
+		t.Errorf("expect let to bind variables for a single execution only")
+	}
+}
+
+func TestNumericFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"negative": -2.5,
+		"positive": 2.5,
+		"int":      int32(-3),
+		"name":     "pod",
+		"deltas":   []interface{}{-1.5, 0.2, 3.0, -4.0},
+	}
+	tests := []jsonpathTest{
+		{"abs float", `{abs(.negative)}`, data, "2.5", false},
+		{"abs int", `{abs(.int)}`, data, "3", false},
+		{"abs int literal", `{abs(-7)}`, data, "7", false},
+		{"floor", `{floor(.negative)}`, data, "-3", false},
+		{"ceil", `{ceil(.negative)}`, data, "-2", false},
+		{"round", `{round(.positive)}`, data, "3", false},
+		{"round half away from zero", `{round(.negative)}`, data, "-3", false},
+		{"round int", `{round(.int)}`, data, "-3", false},
+		{"non numeric", `{abs(.name)}`, data, "", false},
+		{"missing", `{floor(.missing)}`, data, "", true},
+		{"several values", `{ceil(.deltas[*])}`, data, "", false},
+		{"in filter", `{.deltas[?(abs(@) > 1.0)]}`, data, "-1.5 3 -4", false},
+		{"wrong arity", `{abs(.int, .int)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+
+	allowMissing := []jsonpathTest{
+		{"missing", `{floor(.missing)}`, data, "", false},
+	}
+	testJSONPath(allowMissing, true, t)
+}
+
+func TestStringFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"name":  "  MyApp ",
+		"count": 3.0,
+		"items": []interface{}{
+			map[string]interface{}{"name": "Foo"},
+			map[string]interface{}{"name": " foo\t"},
+			map[string]interface{}{"name": "Bar"},
+		},
+	}
+	tests := []jsonpathTest{
+		{"lower", `{lower(.name)}`, data, "  myapp ", false},
+		{"upper", `{upper(.name)}`, data, "  MYAPP ", false},
+		{"trim", `[{trim(.name)}]`, data, "[MyApp]", false},
+		{"nested", `[{lower(trim(.name))}]`, data, "[myapp]", false},
+		{"lower in filter", `{.items[?(lower(@.name)=="foo")].name}`, data, "Foo", false},
+		{"trim in filter", `{.items[?(trim(lower(@.name))=="foo")].name}`, data, "Foo  foo\t", false},
+		{"right operand", `{.items[?("BAR"==upper(@.name))].name}`, data, "Bar", false},
+		{"non string", `{upper(.count)}`, data, "", false},
+		{"wrong arity", `{trim(.name, .name)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestEncodingFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"cert":    "-----BEGIN CERTIFICATE-----\nMII=",
+		"encoded": "aGVsbG8gd29ybGQ=",
+		"invalid": "not base64!",
+		"name":    "a b&c=d/é",
+		"port":    80.0,
+	}
+	tests := []jsonpathTest{
+		{"b64enc", `{b64enc(.cert)}`, data, "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JST0=", false},
+		{"b64dec", `{b64dec(.encoded)}`, data, "hello world", false},
+		{"b64 round trip", `{b64dec(b64enc(.cert))}`, data, "-----BEGIN CERTIFICATE-----\nMII=", false},
+		{"b64dec invalid", `{b64dec(.invalid)}`, data, "", true},
+		{"urlquery", `{urlquery(.name)}`, data, "a+b%26c%3Dd%2F%C3%A9", false},
+		{"b64 in filter", `{[?(b64enc(@)=="aGVsbG8gd29ybGQ=")]}`, []interface{}{"hello world", "bye"}, "hello world", false},
+		{"non string", `{b64enc(.port)}{b64dec(.port)}{urlquery(.port)}`, data, "", false},
+		{"wrong arity", `{b64dec(.name, .name)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+
+	// urlquery produces query parameters which decode to the original value
+	j := New("urlquery round trip")
+	if err := j.Parse(`{urlquery(.name)}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := url.QueryUnescape(buf.String()); err != nil || decoded != data["name"] {
+		t.Errorf("expect %q to decode to %q, got %q, %v", buf.String(), data["name"], decoded, err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	data := map[string]interface{}{
+		"csv":   "a,b,,c",
+		"empty": "",
+		"count": 3.0,
+		"items": []interface{}{
+			map[string]interface{}{"name": "x", "tags": "web,db"},
+			map[string]interface{}{"name": "y", "tags": "cache"},
+		},
+	}
+	tests := []jsonpathTest{
+		{"split", `{split(.csv, ",")}`, data, "a b  c", false},
+		{"multi character separator", `{split(.csv, ",,")}`, data, "a,b c", false},
+		{"no separator found", `{split(.csv, ";")}`, data, "a,b,,c", false},
+		{"empty", `{split(.empty, ",")}`, data, "", false},
+		{"in range", `{range .items[*]}{.name}:{split(.tags, ",")};{end}`, data, "x:web db;y:cache;", false},
+		{"in filter", `{.items[?("db" in split(@.tags, ","))].name}`, data, "x", false},
+		{"non string", `{split(.count, ",")}`, data, "", false},
+		{"non string separator", `{split(.csv, 1)}`, data, "", true},
+		{"wrong arity", `{split(.csv)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestJoin(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"metadata": map[string]interface{}{"name": "a"}, "replicas": 1.0},
+			map[string]interface{}{"metadata": map[string]interface{}{"name": "b"}, "replicas": 2.5},
+		},
+		"ports": []int{80, 443},
+		"sep":   "|",
+		"tags":  []interface{}{"web", 2.0, true, nil, []interface{}{"x"}},
+	}
+	tests := []jsonpathTest{
+		{"strings", `{join(.items[*].metadata.name, ", ")}`, data, "a, b", false},
+		{"numbers", `{join(.items[*].replicas, "+")}`, data, "1+2.5", false},
+		{"array", `{join(.ports, ":")}`, data, "80:443", false},
+		{"mixed array", `{join(.tags[*], ", ")}`, data, `web, 2, true, <nil>, ["x"]`, false},
+		{"objects", `{join(.items[*].metadata, ";")}`, data, `{"name":"a"};{"name":"b"}`, false},
+		{"separator from data", `{join(.ports, .sep)}`, data, "80|443", false},
+		{"empty set", `[{join(.items[?(@.replicas > 5.0)].metadata.name, ",")}]`, data, "[]", false},
+		{"missing", `[{join(.missing[*], ",")}]`, data, "", true},
+		{"non string separator", `{join(.ports, 1)}`, data, "", true},
+		{"wrong arity", `{join(.ports)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+
+	allowMissing := []jsonpathTest{
+		{"missing", `[{join(.missing[*], ",")}]`, data, "[]", false},
+	}
+	testJSONPath(allowMissing, true, t)
+}
+
+func TestFirstLast(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "size": 1.0},
+			map[string]interface{}{"name": "b", "size": 3.0},
+			map[string]interface{}{"name": "c", "size": 2.0},
+		},
+		"single": []interface{}{"only"},
+		"empty":  []interface{}{},
+	}
+	tests := []jsonpathTest{
+		{"first", `{first(.items[*].name)}`, data, "a", false},
+		{"last", `{last(.items[*].name)}`, data, "c", false},
+		{"array", `{first(.single)}{last(.single)}`, data, "onlyonly", false},
+		{"single element", `{first(.single[*])} {last(.single[*])}`, data, "only only", false},
+		{"field of result", `{first(.items[*]).name} {last(.items[*]).size}`, data, "a 2", false},
+		{"filtered", `{last(.items[?(@.size < 3.0)]).name}`, data, "c", false},
+		{"empty", `[{first(.empty[*])}{last(.empty)}]`, data, "[]", false},
+		{"in filter", `{.items[?(@.name == last($.items[*].name))].size}`, data, "2", false},
+		{"wrong arity", `{first(.items, .single)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestSort(t *testing.T) {
+	data := map[string]interface{}{
+		"numbers": []interface{}{3.0, 1.5, 10.0, -2.0, 1.5},
+		"names":   []interface{}{"web", "api", "db", "Cache"},
+		"mixed":   []interface{}{"a", 1.0},
+		"kinds":   []interface{}{3, 1.5, int8(2)},
+		"labels":  map[string]interface{}{"zone": "b", "app": "c", "tier": "a"},
+		"empty":   []interface{}{},
+	}
+	tests := []jsonpathTest{
+		{"numbers", `{sort(.numbers[*])}`, data, "-2 1.5 1.5 3 10", false},
+		{"strings", `{sort(.names[*])}`, data, "Cache api db web", false},
+		{"array", `{sort(.names)}`, data, "Cache api db web", false},
+		{"map values", `{sort(.labels.*)}`, data, "a b c", false},
+		{"map keys", `{sort(.labels.~)}`, data, "app tier zone", false},
+		{"joined", `{join(sort(.labels.*), ",")}`, data, "a,b,c", false},
+		{"empty", `[{sort(.empty[*])}]`, data, "[]", false},
+		{"mixed types", `{sort(.mixed[*])}`, data, "", true},
+		{"integers and floats", `{sort(.kinds[*])}`, data, "1.5 2 3", false},
+		{"wrong arity", `{sort(.names, .numbers)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+
+	dec := json.NewDecoder(strings.NewReader(`{"a": [10, 9, 2.5, 100]}`))
+	dec.UseNumber()
+	var numbers interface{}
+	if err := dec.Decode(&numbers); err != nil {
+		t.Fatal(err)
+	}
+	testJSONPath([]jsonpathTest{
+		{"json numbers", `{sort(.a[*])}`, numbers, "2.5 9 10 100", false},
+	}, false, t)
+
+	// without sort the order of map values is random
+	j := New("deterministic")
+	if err := j.Parse(`{sort(.labels.*)}`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, data); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "a b c" {
+			t.Fatalf("expect sorted map values, got %q", buf.String())
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	data := map[string]interface{}{"items": items}
+	tests := []jsonpathTest{
+		{"window", `{window(.items[*], 10, 5)}`, data, "10 11 12 13 14", false},
+		{"array", `{window(.items, 97, 2)}`, data, "97 98", false},
+		{"from the start", `{window(.items[*], 0, 3)}`, data, "0 1 2", false},
+		{"count beyond the end", `{window(.items[*], 98, 5)}`, data, "98 99", false},
+		{"offset beyond the end", `[{window(.items[*], 100, 5)}]`, data, "[]", false},
+		{"zero count", `[{window(.items[*], 0, 0)}]`, data, "[]", false},
+		{"of filtered values", `{window(.items[?(@ > 50)], 2, 2)}`, data, "53 54", false},
+		{"negative offset", `{window(.items[*], -1, 5)}`, data, "", true},
+		{"non integer count", `{window(.items[*], 1, "5")}`, data, "", true},
+		{"wrong arity", `{window(.items[*], 1)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestUnique(t *testing.T) {
+	data := map[string]interface{}{
+		"people": []interface{}{
+			map[string]interface{}{"firstName": "John", "age": 85.0},
+			map[string]interface{}{"firstName": "Jane", "age": 30.0},
+			map[string]interface{}{"firstName": "Alexander", "age": 90.0},
+			map[string]interface{}{"firstName": "John", "age": 20.0},
+		},
+		"objects": []interface{}{
+			map[string]interface{}{"a": 1.0},
+			map[string]interface{}{"a": 1.0},
+			map[string]interface{}{"a": 2.0},
+		},
+	}
+	tests := []jsonpathTest{
+		{"overlapping selectors", `{.people[0:3,2].firstName}`, data, "John Jane Alexander Alexander", false},
+		{"overlapping selectors deduplicated", `{unique(.people[0:3,2].firstName)}`, data, "John Jane Alexander", false},
+		{"equal values of different elements", `{unique(.people[*].firstName)}`, data, "John Jane Alexander", false},
+		{"objects", `{unique(.objects[*])}`, data, `{"a":1} {"a":2}`, false},
+		{"array", `{unique(.objects)}`, data, `{"a":1} {"a":2}`, false},
+		{"wrong arity", `{unique(.people, .objects)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestQuantifiers(t *testing.T) {
+	data := map[string]interface{}{
+		"series": []interface{}{
+			map[string]interface{}{"name": "positive", "values": []interface{}{1.0, 2.0, 3.0}},
+			map[string]interface{}{"name": "mixed", "values": []interface{}{1.0, -2.0, 3.0}},
+			map[string]interface{}{"name": "negative", "values": []interface{}{-1.0, -2.0}},
+			map[string]interface{}{"name": "empty", "values": []interface{}{}},
+		},
+		"pods": []interface{}{
+			map[string]interface{}{"name": "a", "containers": []interface{}{
+				map[string]interface{}{"ready": true}, map[string]interface{}{"ready": true},
+			}},
+			map[string]interface{}{"name": "b", "containers": []interface{}{
+				map[string]interface{}{"ready": true}, map[string]interface{}{"ready": false},
+			}},
+		},
+	}
+	tests := []jsonpathTest{
+		{"all positive", `{.series[?(all(@.values[*], "@ > 0.0"))].name}`, data, "positive empty", false},
+		{"any negative", `{.series[?(any(@.values[*], "@ < 0.0"))].name}`, data, "mixed negative", false},
+		{"all of an array", `{.series[?(all(@.values, "@ < 0.0"))].name}`, data, "negative empty", false},
+		{"fields of elements", `{.pods[?(all(@.containers[*], "@.ready == true"))].name}`, data, "a", false},
+		{"standalone", `{all(.series[0].values[*], "@ >= 1.0")} {any(.series[0].values[*], "@ > 5.0")}`, data, "true false", false},
+		{"using variables", `{.series[?(any(@.values[*], "@ == $v"))].name}`, data, "positive mixed", false},
+		{"invalid expression", `{all(.series[*], "@.name ==")}`, data, "", true},
+		{"non string expression", `{any(.series[*], 1)}`, data, "", true},
+		{"wrong arity", `{all(.series[*])}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.BindVariable("v", 3.0) }, t)
+
+	options := []jsonpathTest{
+		{"missing keys", `{.pods[?(any(@.containers[*], "@.image == 'nginx'"))].name}`, data, "", false},
+		{"glob names", `{.pods[?(all(@.containers[*], "@.rea* == true"))].name}`, data, "a", false},
+	}
+	testJSONPathWithSetup(options, func(j *JSONPath) {
+		j.AllowMissingKeys(true)
+		j.GlobNames(true)
+	}, t)
+
+	strict := []jsonpathTest{
+		{"missing keys", `{.pods[?(any(@.containers[*], "@.image == 'nginx'"))].name}`, data, "", true},
+	}
+	testJSONPath(strict, false, t)
+
+	j := New("registered")
+	calls := 0
+	j.RegisterFunction("ready", func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		calls++
+		return args[0], nil
+	})
+	if err := j.Parse(`{.pods[?(all(@.containers[*], "ready(@.ready) == true"))].name}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "a" || calls != 4 {
+		t.Errorf("expect a from 4 calls of the registered function, got %q from %d", buf.String(), calls)
+	}
+	if len(j.predicates.parsers) != 1 {
+		t.Errorf("expect the filter expression to be parsed once, got %d parsers", len(j.predicates.parsers))
+	}
+}
+
+func TestValue(t *testing.T) {
+	name := "web"
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "ports": []interface{}{80.0}},
+			map[string]interface{}{"name": "b", "ports": []interface{}{80.0, 443.0}},
+			map[string]interface{}{"name": "c", "ports": []interface{}{}},
+		},
+		"pointer": &name,
+	}
+	tests := []jsonpathTest{
+		{"singleton", `{value(.items[0].ports[*])}`, data, "80", false},
+		{"empty", `[{value(.items[2].ports[*])}]`, data, "[]", false},
+		{"several values", `[{value(.items[1].ports[*])}]`, data, "[]", false},
+		{"missing", `[{value(.missing)}]`, data, "", true},
+		{"pointer", `{value(.pointer)}`, data, "web", false},
+		{"in filter", `{.items[?(value(@.ports[*]) == 80.0)].name}`, data, "a", false},
+		{"wrong arity", `{value(.items, .items)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+
+	allowMissing := []jsonpathTest{
+		{"missing", `[{value(.missing)}]`, data, "[]", false},
+	}
+	testJSONPath(allowMissing, true, t)
+}
+
+func TestUnregisterFunction(t *testing.T) {
+	count := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		return []reflect.Value{reflect.ValueOf(len(args[0]))}, nil
+	}
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	j := New("registry")
+	names := j.RegisteredFunctions()
+	if !contains(names, "sum") || !contains(names, "all") || contains(names, "count") {
+		t.Errorf("expect builtin functions only, got %v", names)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("expect sorted names, got %v", names)
+	}
+
+	j.RegisterFunction("count", count)
+	if !contains(j.RegisteredFunctions(), "count") {
+		t.Errorf("expect count to be registered")
+	}
+	if err := j.UnregisterFunction("count"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if contains(j.RegisteredFunctions(), "count") {
+		t.Errorf("expect count to be unregistered")
+	}
+	if err := j.UnregisterFunction("count"); err == nil || err.Error() != "function count is not registered" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// builtin functions can be removed
+	for _, name := range []string{"sum", "any"} {
+		if err := j.UnregisterFunction(name); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if names := j.RegisteredFunctions(); contains(names, "sum") || contains(names, "any") {
+		t.Errorf("expect sum and any to be unregistered, got %v", names)
+	}
+	data := map[string]interface{}{"items": []interface{}{1.0, 2.0}}
+	tests := []jsonpathTest{
+		{"unregistered builtin", `{sum(.items[*])}`, data, "", true},
+		{"unregistered quantifier", `{any(.items[*], "@ > 1.0")}`, data, "", true},
+		{"unregistered inside quantifier", `{all(.items[*], "sum(@) > 0.0")}`, data, "", true},
+		{"other builtins", `{max(.items[*])}`, data, "2", false},
+	}
+	for _, test := range tests {
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		err := j.Execute(buf, test.input)
+		if test.expectError != (err != nil) {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+		} else if !test.expectError && buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+
+	// registering a function of the same name replaces the removed builtin
+	j.RegisterFunction("sum", count)
+	if err := j.Parse(`{sum(.items[*])}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil || buf.String() != "2" {
+		t.Errorf("expect registered sum, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestFunctionArity(t *testing.T) {
+	count := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		return []reflect.Value{reflect.ValueOf(len(args))}, nil
+	}
+	tests := []struct {
+		name     string
+		setup    func(j *JSONPath)
+		template string
+		err      string
+	}{
+		{"builtin", func(j *JSONPath) {}, `{.items[?(first(@, @))]}`,
+			"function first expects 1 argument, got 2 at position 10"},
+		{"registered without arity", func(j *JSONPath) { j.RegisterFunction("count", count) }, `{count(.a, .b)}`, ""},
+		{"registered with arity", func(j *JSONPath) { j.RegisterFunctionWithArity("count", count, Arity{1, 2}) },
+			`{count(.a, .b, .c)}`, "function count expects 1 or 2 arguments, got 3 at position 1"},
+		{"registered with unlimited arity", func(j *JSONPath) { j.RegisterFunctionWithArity("count", count, Arity{2, -1}) },
+			`{count(.a)}`, "function count expects at least 2 arguments, got 1 at position 1"},
+		{"builtin replaced", func(j *JSONPath) { j.RegisterFunction("sum", count) }, `{sum(.a, .b)}`, ""},
+		{"builtin unregistered", func(j *JSONPath) { j.UnregisterFunction("sum") }, `{sum(.a, .b)}`, ""},
+		{"arity removed with registered function", func(j *JSONPath) {
+			j.RegisterFunctionWithArity("count", count, Arity{1, 1})
+			j.RegisterFunction("count", count)
+		}, `{count(.a, .b)}`, ""},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		test.setup(j)
+		err := j.Parse(test.template)
+		var out string
+		if err != nil {
+			out = err.Error()
+		}
+		if out != test.err {
+			t.Errorf("in %s, expect to get error %q, got %q", test.name, test.err, out)
+		}
+	}
+
+	// the predicate of a quantifier is parsed on execution, with the same arities
+	j := New("quantifier")
+	j.RegisterFunctionWithArity("count", count, Arity{1, 1})
+	if err := j.Parse(`{any(.items, "count(@, @) > 0")}`); err != nil {
+		t.Fatal(err)
+	}
+	err := j.Execute(new(bytes.Buffer), map[string]interface{}{"items": []interface{}{1.0}})
+	if err == nil || !strings.Contains(err.Error(), "function count expects 1 argument, got 2") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNamespacedFunctions(t *testing.T) {
+	custom := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		return []reflect.Value{reflect.ValueOf(fmt.Sprintf("custom %d", len(args)))}, nil
+	}
+	data := map[string]interface{}{
+		"name":  "pod1",
+		"myns":  map[string]interface{}{"custom": "field"},
+		"items": []interface{}{"a", "b"},
+	}
+	tests := []jsonpathTest{
+		{"dot", `{myns.custom(.name)}`, data, "custom 1", false},
+		{"colon", `{other:custom(.name, .items)}`, data, "custom 2", false},
+		{"pipe", `{.items | myns.custom}`, data, "custom 1", false},
+		{"filter", `{.items[?(myns.custom(@) == "custom 1")]}`, data, "a b", false},
+		{"field", `{.myns.custom}`, data, "field", false},
+		{"other namespace", `{yourns.custom(.name)}`, data, "", true},
+		{"without namespace", `{custom(.name)}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.RegisterFunction("myns.custom", custom)
+		j.RegisterFunction("other:custom", custom)
+	}, t)
+}
+
+func TestPercent(t *testing.T) {
+	var input = []byte(`{"volumes": [
+		{"name": "root", "used": 95, "total": 100},
+		{"name": "data", "used": 450, "total": 1000},
+		{"name": "logs", "used": 19.5, "total": 20},
+		{"name": "empty", "used": 0, "total": 0}
+	], "broken": {"used": "full", "total": 10}}`)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		t.Fatal(err)
+	}
+	typed := map[string]interface{}{"used": 3, "total": uint(4)}
+	tests := []jsonpathTest{
+		{"above threshold", `{.volumes[?(percent(@.used, @.total) > 90.0)].name}`, data, "root logs", false},
+		{"below threshold", `{.volumes[?(percent(@.used, @.total) < 50.0)].name}`, data, "data", false},
+		{"value", `{percent(.volumes[1].used, .volumes[1].total)}`, data, "45", false},
+		{"zero total", `{percent(.volumes[3].used, .volumes[3].total)}`, data, "", false},
+		{"zero total in filter", `{.volumes[?(percent(@.used, @.total) >= 0.0)].name}`, data, "root data logs", false},
+		{"integers", `{percent(.used, .total)}`, typed, "75", false},
+		{"not a number", `{percent(.broken.used, .broken.total)}`, data, "", true},
+		{"wrong arity", `{percent(.used)}`, typed, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestAge(t *testing.T) {
+	defer func(clock func() time.Time) { ageClock = clock }(ageClock)
+	ageClock = func() time.Time { return time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	var input = []byte(`{"items": [
+		{"metadata": {"name": "fresh", "creationTimestamp": "2023-05-01T11:30:00Z"}},
+		{"metadata": {"name": "stale", "creationTimestamp": "2023-05-01T10:00:00Z"}},
+		{"metadata": {"name": "offset", "creationTimestamp": "2023-05-01T12:30:00+02:00"}},
+		{"metadata": {"name": "invalid", "creationTimestamp": "yesterday"}}
+	]}`)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		t.Fatal(err)
+	}
+	tests := []jsonpathTest{
+		{"older than an hour", `{.items[?(age(@.metadata.creationTimestamp) > 3600.0)].metadata.name}`, data, "stale offset", false},
+		{"younger than an hour", `{.items[?(age(@.metadata.creationTimestamp) <= 3600.0)].metadata.name}`, data, "fresh", false},
+		{"seconds", `{age(.items[0].metadata.creationTimestamp)}`, data, "1800", false},
+		{"fractional seconds", `{age("2023-05-01T11:59:59.5Z")}`, data, "0.5", false},
+		{"invalid timestamp", `{age(.items[3].metadata.creationTimestamp)}`, data, "", false},
+		{"not a string", `{age(.items)}`, data, "", false},
+		{"wrong arity", `{age()}`, data, "", true},
+		{"missing", `{age(.items[0].metadata.deletionTimestamp)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestAvg(t *testing.T) {
+	var input = []byte(`{
+		"nums": [3, 9, 4, 12, 2],
+		"items": [
+			{"name": "a", "cpu": 1},
+			{"name": "b", "cpu": 5},
+			{"name": "c", "cpu": 3}
+		],
+		"words": ["one"],
+		"empty": []
+	}`)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		t.Fatal(err)
+	}
+	typed := map[string]interface{}{"nums": []int{1, 2, 6}}
+	tests := []jsonpathTest{
+		{"value", `{avg(.nums)}`, data, "6", false},
+		{"above average", `{.nums[?(@ > avg($.nums[*]))]}`, data, "9 12", false},
+		{"below average", `{.nums[?(@ < avg($.nums))]}`, data, "3 4 2", false},
+		{"average on the left", `{.nums[?(avg($.nums[*]) <= @)]}`, data, "9 12", false},
+		{"fields above average", `{.items[?(@.cpu > avg($.items[*].cpu))].name}`, data, "b", false},
+		{"fields at most average", `{.items[?(@.cpu <= avg($.items[*].cpu))].name}`, data, "a c", false},
+		{"integers", `{avg(.nums)}`, typed, "3", false},
+		{"empty", `{avg(.empty)}`, data, "", false},
+		{"non numeric", `{avg(.words)}`, data, "", true},
+		{"wrong arity", `{avg(.nums, .nums)}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestFunctionMissingArguments(t *testing.T) {
+	data := map[string]interface{}{"name": "web", "labels": map[string]interface{}{"app": "shop"}}
+	tests := []jsonpathTest{
+		{"match", `{match(.typo, "b")}`, data, "", true},
+		{"upper", `{upper(.labels.typo)}`, data, "", true},
+		{"in filter", `{.labels[?(upper(@.typo) == "SHOP")]}`, data, "", true},
+		{"coalesce", `{coalesce(.nickname, .name)}`, data, "web", false},
+		{"coalesce of missing keys", `[{coalesce(.nickname, .alias)}]`, data, "[]", false},
+		{"nested in coalesce", `{coalesce(upper(.nickname), .name)}`, data, "web", false},
+	}
+	testJSONPath(tests, false, t)
+
+	allowMissing := []jsonpathTest{
+		{"match", `{match(.typo, "b")}`, data, "false", false},
+		{"upper", `[{upper(.labels.typo)}]`, data, "[]", false},
+	}
+	testJSONPath(allowMissing, true, t)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ExecuteToGoLiteral returns the values found by the template, see ExecuteToValues, as
+// Go source of a []interface{} composite literal, e.g. []interface{}{"a", 1}.
+// Maps are written in the order of their sorted keys. Values which cannot be written as a
+// literal, e.g. structs, pointers or functions, are an error.
+func (j *JSONPath) ExecuteToGoLiteral(data interface{}) (string, error) {
+	values, err := j.ExecuteToValues(data)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := writeGoLiteral(&buf, reflect.ValueOf(values)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeGoLiteral writes the Go source of the value
+func writeGoLiteral(buf *bytes.Buffer, value reflect.Value) error {
+	if !value.IsValid() {
+		buf.WriteString("nil")
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Interface:
+		if value.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		return writeGoLiteral(buf, value.Elem())
+	case reflect.String:
+		writeConversion(buf, value, reflect.String, strconv.Quote(value.String()))
+	case reflect.Bool:
+		writeConversion(buf, value, reflect.Bool, strconv.FormatBool(value.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeConversion(buf, value, reflect.Int, strconv.FormatInt(value.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeConversion(buf, value, reflect.Int, strconv.FormatUint(value.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := value.Float()
+		var s string
+		switch {
+		case math.IsInf(f, 1):
+			s = "math.Inf(1)"
+		case math.IsInf(f, -1):
+			s = "math.Inf(-1)"
+		case math.IsNaN(f):
+			s = "math.NaN()"
+		default:
+			s = strconv.FormatFloat(f, 'g', -1, value.Type().Bits())
+			if !strings.ContainsAny(s, ".e") {
+				s += ".0"
+			}
+		}
+		writeConversion(buf, value, reflect.Float64, s)
+	case reflect.Slice:
+		if value.IsNil() {
+			fmt.Fprintf(buf, "%s(nil)", goTypeName(value.Type()))
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		fmt.Fprintf(buf, "%s{", goTypeName(value.Type()))
+		for i := 0; i < value.Len(); i++ {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeGoLiteral(buf, value.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	case reflect.Map:
+		if value.IsNil() {
+			fmt.Fprintf(buf, "%s(nil)", goTypeName(value.Type()))
+			return nil
+		}
+		fmt.Fprintf(buf, "%s{", goTypeName(value.Type()))
+		for i, key := range sortedMapKeys(value) {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeGoLiteral(buf, key); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+			if err := writeGoLiteral(buf, value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	default:
+		return fmt.Errorf("%s cannot be written as a Go literal", value.Type())
+	}
+	return nil
+}
+
+// writeConversion writes the literal, converted to the type of the value unless it is
+// the default type of the literal
+func writeConversion(buf *bytes.Buffer, value reflect.Value, kind reflect.Kind, literal string) {
+	if value.Type().Name() == kind.String() && value.Type().PkgPath() == "" {
+		buf.WriteString(literal)
+		return
+	}
+	fmt.Fprintf(buf, "%s(%s)", goTypeName(value.Type()), literal)
+}
+
+// goTypeName returns the name of the type as written in Go source
+func goTypeName(t reflect.Type) string {
+	return strings.ReplaceAll(t.String(), "interface {}", "interface{}")
+}
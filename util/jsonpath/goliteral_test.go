@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"go/parser"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExecuteToGoLiteral(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "ready": true, "replicas": 1, "cpu": 0.5, "owner": nil},
+			map[string]interface{}{"name": "pod \"2\"", "ready": false, "replicas": 2, "cpu": float64(2)},
+		},
+		"ports":  []int32{80, 443},
+		"labels": map[string]string{"b": "2", "a": "1"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+		values   []interface{}
+	}{
+		{"scalars", `{.items[*].name}`, `[]interface{}{"pod1", "pod \"2\""}`,
+			[]interface{}{"pod1", "pod \"2\""}},
+		{"numbers", `{.items[*].replicas}{.items[*].cpu}`, `[]interface{}{1, 2, 0.5, 2.0}`,
+			[]interface{}{1, 2, 0.5, 2.0}},
+		{"bools and nil", `{.items[0].ready}{.items[0].owner}`, `[]interface{}{true, nil}`,
+			[]interface{}{true, nil}},
+		{"typed slice", `{.ports}`, `[]interface{}{[]int32{int32(80), int32(443)}}`,
+			[]interface{}{[]int32{int32(80), int32(443)}}},
+		{"typed map", `{.labels}`, `[]interface{}{map[string]string{"a": "1", "b": "2"}}`,
+			[]interface{}{map[string]string{"a": "1", "b": "2"}}},
+		{"object", `{.items[1]}`,
+			`[]interface{}{map[string]interface{}{"cpu": 2.0, "name": "pod \"2\"", "ready": false, "replicas": 2}}`,
+			[]interface{}{map[string]interface{}{"cpu": 2.0, "name": "pod \"2\"", "ready": false, "replicas": 2}}},
+		{"empty", `{.items[?(@.replicas>5)]}`, `[]interface{}{}`, []interface{}{}},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		got, err := j.ExecuteToGoLiteral(data)
+		if err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if got != test.expect {
+			t.Errorf("in %s, expect %s, got %s", test.name, test.expect, got)
+		}
+		if _, err := parser.ParseExpr(got); err != nil {
+			t.Errorf("in %s, %s is not valid Go: %v", test.name, got, err)
+		}
+		// the expected values are written as the expected source, so they round-trip
+		values, err := j.ExecuteToValues(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("in %s, expect values %#v, got %#v", test.name, test.values, values)
+		}
+	}
+}
+
+func TestExecuteToGoLiteralSpecialFloats(t *testing.T) {
+	data := map[string]interface{}{
+		"values": []interface{}{math.Inf(1), math.Inf(-1), math.NaN(), 1e21},
+		"single": []float32{float32(math.Inf(1))},
+	}
+	j := New("floats")
+	if err := j.Parse(`{.values}{.single}`); err != nil {
+		t.Fatal(err)
+	}
+	got, err := j.ExecuteToGoLiteral(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `[]interface{}{[]interface{}{math.Inf(1), math.Inf(-1), math.NaN(), 1e+21}, []float32{float32(math.Inf(1))}}`
+	if got != expect {
+		t.Errorf("expect %s, got %s", expect, got)
+	}
+	if _, err := parser.ParseExpr(got); err != nil {
+		t.Errorf("%s is not valid Go: %v", got, err)
+	}
+}
+
+func TestExecuteToGoLiteralError(t *testing.T) {
+	type pod struct {
+		Name string
+	}
+	name := "pod1"
+	data := map[string]interface{}{
+		"pod":     pod{Name: "pod1"},
+		"created": time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		"owner":   &name,
+		"nested":  []interface{}{map[string]interface{}{"pod": pod{}}},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+	}{
+		{"struct", `{.pod}`, "jsonpath.pod cannot be written as a Go literal"},
+		{"time", `{.created}`, "time.Time cannot be written as a Go literal"},
+		{"pointer", `{.owner}`, "*string cannot be written as a Go literal"},
+		{"nested struct", `{.nested}`, "jsonpath.pod cannot be written as a Go literal"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		got, err := j.ExecuteToGoLiteral(data)
+		if err == nil {
+			t.Errorf("in %s, expect an error, got %s", test.name, got)
+			continue
+		}
+		if err.Error() != test.expect {
+			t.Errorf("in %s, expect error %q, got %q", test.name, test.expect, err)
+		}
+	}
+}
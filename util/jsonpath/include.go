@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// RegisterSubTemplate makes the parsed template t available as name to include directives,
+// e.g. {range .items[*]}{include "pod-summary"}{end} prints the output of t executed on
+// every item. Including a template which is already being executed is an error.
+func (j *JSONPath) RegisterSubTemplate(name string, t *JSONPath) {
+	if j.subTemplates == nil {
+		j.subTemplates = map[string]*JSONPath{}
+	}
+	j.subTemplates[name] = t
+}
+
+// evalInclude evaluates IncludeNode, the output of the sub-template executed on each input
+// is printed like the text of the template
+func (j *JSONPath) evalInclude(input []located, node *IncludeNode) ([]located, error) {
+	sub, ok := j.subTemplates[node.Name]
+	if !ok {
+		return input, fmt.Errorf("template %s is not registered", node.Name)
+	}
+	for _, t := range j.includes {
+		if t == sub {
+			return input, fmt.Errorf("recursive include of template %s", node.Name)
+		}
+	}
+	results := []located{}
+	for _, in := range input {
+		var data interface{}
+		if in.value.IsValid() && in.value.CanInterface() {
+			data = in.value.Interface()
+		}
+		exec := sub.execution()
+		exec.includes = append(append([]*JSONPath{}, j.includes...), sub)
+		var buf bytes.Buffer
+		if err := exec.execute(&buf, data); err != nil {
+			return input, fmt.Errorf("template %s: %v", node.Name, err)
+		}
+		results = append(results, located{value: reflect.ValueOf(buf.String()), text: true})
+	}
+	return results, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, name, template string) *JSONPath {
+	t.Helper()
+	j := New(name)
+	if err := j.Parse(template); err != nil {
+		t.Fatalf("parse %s error %v", template, err)
+	}
+	return j
+}
+
+func TestInclude(t *testing.T) {
+	data := map[string]interface{}{
+		"kind": "List",
+		"items": []interface{}{
+			map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "web"},
+				"status":   map[string]interface{}{"phase": "Running"},
+			},
+			map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "db"},
+				"status":   map[string]interface{}{"phase": "Pending"},
+			},
+		},
+	}
+	summary := mustParse(t, "pod-summary", `{.metadata.name}={.status.phase}`)
+	name := mustParse(t, "name", `<{.metadata.name}>`)
+	nested := mustParse(t, "nested", `[{include "name"}]`)
+	nested.RegisterSubTemplate("name", name)
+
+	tests := []struct {
+		name        string
+		template    string
+		expect      string
+		expectError string
+	}{
+		{"range", `{.kind}: {range .items[*]}{include "pod-summary"}; {end}`, "List: web=Running; db=Pending; ", ""},
+		{"single quotes", `{range .items[*]}{include 'name'}{end}`, "<web><db>", ""},
+		{"nested", `{range .items[*]}{include "nested"}{end}`, "[<web>][<db>]", ""},
+		{"root", `{include "kind"}`, "List", ""},
+		{"unknown template", `{include "missing"}`, "", "template missing is not registered"},
+		{"failing template", `{include "pod-summary"}`, "", "template pod-summary: metadata is not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j := mustParse(t, test.name, test.template)
+			j.RegisterSubTemplate("pod-summary", summary)
+			j.RegisterSubTemplate("name", name)
+			j.RegisterSubTemplate("nested", nested)
+			j.RegisterSubTemplate("kind", mustParse(t, "kind", `{.kind}`))
+			buf := new(bytes.Buffer)
+			err := j.Execute(buf, data)
+			if test.expectError != "" {
+				if err == nil || err.Error() != test.expectError {
+					t.Errorf("expected error %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("execute %s error %v", test.template, err)
+			}
+			if out := buf.String(); out != test.expect {
+				t.Errorf("expected %q, got %q", test.expect, out)
+			}
+		})
+	}
+}
+
+func TestIncludeRecursion(t *testing.T) {
+	data := map[string]interface{}{"a": 1}
+
+	self := mustParse(t, "self", `{.a}{include "self"}`)
+	self.RegisterSubTemplate("self", self)
+	err := self.Execute(new(bytes.Buffer), data)
+	if err == nil || !strings.Contains(err.Error(), "recursive include of template self") {
+		t.Errorf("expected recursive include error, got %v", err)
+	}
+
+	ping := mustParse(t, "ping", `{include "pong"}`)
+	pong := mustParse(t, "pong", `{include "ping"}`)
+	ping.RegisterSubTemplate("pong", pong)
+	pong.RegisterSubTemplate("ping", ping)
+	err = ping.Execute(new(bytes.Buffer), data)
+	if err == nil || !strings.Contains(err.Error(), "recursive include of template pong") {
+		t.Errorf("expected recursive include error, got %v", err)
+	}
+
+	// including the same template twice is no recursion
+	twice := mustParse(t, "twice", `{include "a"},{include "a"}`)
+	twice.RegisterSubTemplate("a", mustParse(t, "a", `{.a}`))
+	buf := new(bytes.Buffer)
+	if err := twice.Execute(buf, data); err != nil || buf.String() != "1,1" {
+		t.Errorf("expected 1,1, got %q and error %v", buf.String(), err)
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	tests := []failParserTest{
+		{"unquoted name", `{include summary}`, "include expects a quoted template name"},
+		{"unterminated name", `{include "summary}`, "unterminated quoted string"},
+		{"include inside action", `{.items include "summary"}`, "include must start an action"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.name, test.text)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("in %s, expect to get error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// NodeIterator is implemented by containers which cannot be iterated through reflection,
+// e.g. sync.Map. When a value implements it, its entries are looked up through Keys and Get
+// instead of being read as a struct or map.
+type NodeIterator interface {
+	// Keys returns the keys of all entries in the order in which they are visited.
+	Keys() []interface{}
+	// Get returns the value stored under the given key, and whether it was found.
+	Get(key interface{}) (interface{}, bool)
+}
+
+// WrapSyncMap returns a NodeIterator over the entries of the given sync.Map, visiting
+// them in the order of their printed keys.
+func WrapSyncMap(m *sync.Map) NodeIterator {
+	return &syncMapIterator{m: m}
+}
+
+type syncMapIterator struct {
+	m *sync.Map
+}
+
+func (s *syncMapIterator) Keys() []interface{} {
+	keys := []interface{}{}
+	s.m.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+func (s *syncMapIterator) Get(key interface{}) (interface{}, bool) {
+	return s.m.Load(key)
+}
+
+// asNodeIterator returns the NodeIterator implemented by the value or by any value
+// it points to.
+func asNodeIterator(value reflect.Value) (NodeIterator, bool) {
+	for value.IsValid() {
+		if value.CanInterface() {
+			if it, ok := value.Interface().(NodeIterator); ok {
+				return it, true
+			}
+		}
+		if (value.Kind() != reflect.Interface && value.Kind() != reflect.Ptr) || value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+	return nil, false
+}
+
+// iteratorChildren returns all entries of the iterator located below the given parent
+func iteratorChildren(parent *located, it NodeIterator) []located {
+	results := []located{}
+	for _, key := range it.Keys() {
+		if child, ok := it.Get(key); ok {
+			results = append(results, located{value: reflect.ValueOf(child), parent: parent, key: fmt.Sprint(key)})
+		}
+	}
+	return results
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestWrapSyncMap(t *testing.T) {
+	pods := &sync.Map{}
+	pods.Store("pod1", map[string]interface{}{"name": "pod1", "phase": "Running"})
+	pods.Store("pod2", map[string]interface{}{"name": "pod2", "phase": "Pending"})
+	pods.Store("pod3", map[string]interface{}{"name": "pod3", "phase": "Running"})
+	data := map[string]interface{}{
+		"kind": "PodCache",
+		"pods": WrapSyncMap(pods),
+	}
+
+	tests := []jsonpathTest{
+		{"key", `{.pods.pod2.phase}`, data, "Pending", false},
+		{"wildcard", `{.pods.*.name}`, data, "pod1 pod2 pod3", false},
+		{"recursive", `{..phase}`, data, "Running Pending Running", false},
+		{"filter", `{.pods[?(@.phase=="Running")].name}`, data, "pod1 pod3", false},
+		{"filter by key", `{.pods[?(@~=="pod2")].phase}`, data, "Pending", false},
+		{"range", `{range .pods.*}{.name}={.phase};{end}`, data, "pod1=Running;pod2=Pending;pod3=Running;", false},
+		{"missing key", `{.pods.pod4}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
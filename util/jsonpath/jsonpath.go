@@ -18,15 +18,83 @@ package jsonpath
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"k8s.io/client-go/third_party/forked/golang/template"
 )
 
+// located is a value found while evaluating a template, together with its location
+// within the data. Literals and the results of functions have no parent.
+type located struct {
+	value  reflect.Value
+	parent *located
+	// key is the index within the parent if it is an array or slice,
+	// and the map key or struct field name otherwise
+	key interface{}
+	// root is set for the data the template is executed on
+	root bool
+	// text is set for the plain and quoted text of the template
+	text bool
+	// missing is set for the null emitted in place of a missing value, see EmitNullForMissing
+	missing bool
+}
+
+// path returns the keys leading from the root of the data to the value,
+// or false if the value is not part of the data, e.g. a literal
+func (l located) path() ([]interface{}, bool) {
+	if l.parent == nil {
+		return []interface{}{}, l.root
+	}
+	path, ok := l.parent.path()
+	if !ok {
+		return nil, false
+	}
+	return append(path, l.key), true
+}
+
+// values returns the values of the located values
+func values(located []located) []reflect.Value {
+	result := make([]reflect.Value, 0, len(located))
+	for _, l := range located {
+		result = append(result, l.value)
+	}
+	return result
+}
+
+// literals wraps values which were not found in the data
+func literals(values []reflect.Value) []located {
+	result := make([]located, 0, len(values))
+	for _, v := range values {
+		result = append(result, located{value: v})
+	}
+	return result
+}
+
+// fieldName returns the name of the struct field used in JSON
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// ErrNoResults is returned by ExecuteOrNoResults when the template matched nothing.
+var ErrNoResults = errors.New("jsonpath: no results")
+
+// ErrOutputTooLarge is returned by Execute when the output exceeds the size set by SetMaxOutputBytes.
+var ErrOutputTooLarge = errors.New("jsonpath: output exceeds maximum size")
+
+// JSONPath is a parsed template. Once it is configured and parsed, it can be executed
+// concurrently, as every execution keeps its state in a copy of the template.
 type JSONPath struct {
 	name       string
 	parser     *Parser
@@ -35,9 +103,67 @@ type JSONPath struct {
 	endRange   int
 
 	lastEndNode *Node
+	matched     int
+	// existenceOnly stops the evaluation at the first match, see Matches
+	existenceOnly bool
+	// root is the data the template is currently executed on
+	root located
+	// trace collects the evaluation steps, see ExecuteTraceBundle
+	trace *[]string
+	// recorded collects the values found by every action, see ExecuteTraceBundle
+	recorded *[][]interface{}
+	// tolerateMissing is set while missing keys must not fail the walk, i.e. while walking
+	// a singular node for EmitNullForMissing or the arguments of a function
+	tolerateMissing bool
+	// continuedErrs are the errors of the actions replaced by the error marker, see ContinueOnError
+	continuedErrs []error
+	// includes are the sub-templates being executed by include, outermost first
+	includes []*JSONPath
+	// each is passed the results of actions which are streamed, see ExecuteEach
+	each func(located) error
+
+	allowMissingKeys   bool
+	sortMapKeys        bool
+	errorOnCycles      bool
+	maxDepth           int
+	skipRangeErrors    bool
+	relaxedComparisons bool
+	strictComparisons  bool
+	coerceNumbers      bool
+	globNames          bool
+	strictEscapes      bool
+	deduplicate        bool
+	exportedOnly       bool
+	labelQueries       bool
+	emitNullForMissing bool
+	maxOutputBytes     int
+	continueOnError    bool
+	errorMarker        string
+	outputJSON         bool
+	condensedJSON      bool
+	outputCSV          bool
+	outputYAML         bool
+	csvColumns         []string
+	unwrapSingleResult bool
+	preferStringer     bool
+	indent             string
+	typedOutput        bool
+	omitEmptyFields    bool
+	flattenScalars     bool
+	flattenDelimiter   string
+	floatFormat        string
+	intFormat          string
 
-	allowMissingKeys bool
-	outputJSON       bool
+	functions              map[string]Function
+	disabledFunctions      map[string]bool
+	arities                map[string]Arity
+	unknownFunctionHandler UnknownFunctionHandler
+	regexps                map[string]*regexp.Regexp
+	variables              map[string]interface{}
+	subTemplates           map[string]*JSONPath
+	descendantKeys         map[string]bool
+	// predicates are the filter expressions of quantifiers parsed so far, see quantify
+	predicates *predicateCache
 }
 
 // New creates a new JSONPath with the given name.
@@ -47,9 +173,26 @@ func New(name string) *JSONPath {
 		beginRange: 0,
 		inRange:    0,
 		endRange:   0,
+		indent:     defaultIndent,
 	}
 }
 
+// CompileAll parses all of the given templates, keyed by their names. It returns the
+// successfully parsed templates and the parse errors of all others, keyed by name.
+func CompileAll(templates map[string]string) (map[string]*JSONPath, map[string]error) {
+	compiled := make(map[string]*JSONPath, len(templates))
+	errs := map[string]error{}
+	for name, text := range templates {
+		j := New(name)
+		if err := j.Parse(text); err != nil {
+			errs[name] = err
+			continue
+		}
+		compiled[name] = j
+	}
+	return compiled, errs
+}
+
 // AllowMissingKeys allows a caller to specify whether they want an error if a field or map key
 // cannot be located, or simply an empty result. The receiver is returned for chaining.
 func (j *JSONPath) AllowMissingKeys(allow bool) *JSONPath {
@@ -57,40 +200,507 @@ func (j *JSONPath) AllowMissingKeys(allow bool) *JSONPath {
 	return j
 }
 
+// RestrictDescendantKeys makes recursive descent (..) only descend into children whose
+// map key or field name is one of the given keys. Array elements are always descended into.
+// Passing nil removes the restriction.
+func (j *JSONPath) RestrictDescendantKeys(keys []string) *JSONPath {
+	if keys == nil {
+		j.descendantKeys = nil
+		return j
+	}
+	j.descendantKeys = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		j.descendantKeys[key] = true
+	}
+	return j
+}
+
+// SortMapKeys makes wildcards and recursive descent visit the entries of maps in the order
+// of their sorted keys, so that e.g. {.labels.~} and {.labels.*} list the keys and values of
+// a map in the same order and the output is the same for every execution. Numeric keys are
+// sorted by value, e.g. 2 before 10. The receiver is returned for chaining.
+func (j *JSONPath) SortMapKeys(sort bool) *JSONPath {
+	j.sortMapKeys = sort
+	return j
+}
+
+// ErrorOnCycles makes recursive descent fail when the data refers back to one of the values
+// containing it. By default such references are not descended into again.
+// The receiver is returned for chaining.
+func (j *JSONPath) ErrorOnCycles(fail bool) *JSONPath {
+	j.errorOnCycles = fail
+	return j
+}
+
+// SetMaxDepth makes recursive descent fail when it would descend more than n levels below
+// the value it starts at. A limit of 0, the default, is unlimited.
+// The receiver is returned for chaining.
+func (j *JSONPath) SetMaxDepth(n int) *JSONPath {
+	j.maxDepth = n
+	return j
+}
+
+// SkipRangeErrors makes an iteration of a range which fails, e.g. because of a missing key,
+// produce no output instead of failing the execution. The receiver is returned for chaining.
+func (j *JSONPath) SkipRangeErrors(skip bool) *JSONPath {
+	j.skipRangeErrors = skip
+	return j
+}
+
+// RelaxedComparisons allows an operand of a filter comparison to select more than one
+// value, in which case the comparison holds if it holds for any of them, e.g.
+// {.items[?(@.primary==@.aliases[*])]}. The receiver is returned for chaining.
+func (j *JSONPath) RelaxedComparisons(relaxed bool) *JSONPath {
+	j.relaxedComparisons = relaxed
+	return j
+}
+
+// SetStrictComparisons makes filter comparisons between values of different types false
+// instead of failing, e.g. {[?(@.a < 10)]} skips items whose a is "5". Numbers of any type
+// are still compared by their value. Values of different types are unequal, so only !=
+// holds for them. The receiver is returned for chaining.
+func (j *JSONPath) SetStrictComparisons(strict bool) *JSONPath {
+	j.strictComparisons = strict
+	return j
+}
+
+// WildcardExportedOnly makes wildcards, keys and recursive descent skip the fields of
+// structs which are unexported or tagged with json:"-", so that generic queries like
+// {.spec.*} do not reveal internals. Such fields can still be selected by name. The
+// receiver is returned for chaining.
+func (j *JSONPath) WildcardExportedOnly(exportedOnly bool) *JSONPath {
+	j.exportedOnly = exportedOnly
+	return j
+}
+
+// SetDeduplicateResults makes every query of the template return each value only once,
+// dropping results deeply equal to an earlier result of the same query, e.g. for {..} on
+// data sharing objects. Each result is compared to all kept results, so the cost grows
+// with the square of the number of results. The receiver is returned for chaining.
+func (j *JSONPath) SetDeduplicateResults(deduplicate bool) *JSONPath {
+	j.deduplicate = deduplicate
+	return j
+}
+
+// GlobNames makes names containing * or ? select all children of a map or struct whose
+// names match them as a pattern, e.g. {.labels['app.*']} selects app.kubernetes.io/name
+// and app.kubernetes.io/part-of. * matches any sequence of characters, including / and .
+// inside quotes, and ? a single character. A \ before * or ? matches it literally. It
+// must be set before Parse to take effect. The receiver is returned for chaining.
+func (j *JSONPath) GlobNames(glob bool) *JSONPath {
+	j.globNames = glob
+	return j
+}
+
+// StrictEscapes makes Parse fail on a \ in the text of the template outside of actions,
+// e.g. the one of {.a}\t{.b}, which would otherwise be printed literally. Quoted strings
+// inside actions, like {"\t"}, still support escape sequences. It must be set before Parse
+// to take effect. The receiver is returned for chaining.
+func (j *JSONPath) StrictEscapes(strict bool) *JSONPath {
+	j.strictEscapes = strict
+	return j
+}
+
+// CoerceNumericStrings makes filter comparisons between a number and a string holding a
+// number compare both as numbers, e.g. {[?(@ > 5)]} selects "8" and 10 of
+// ["8", 4, "2", 10]. Other values, including numbers of different types, compare as
+// without this option. The receiver is returned for chaining.
+func (j *JSONPath) CoerceNumericStrings(coerce bool) *JSONPath {
+	j.coerceNumbers = coerce
+	return j
+}
+
+// ContinueOnError makes an action of the template which fails, e.g. because of a missing
+// key or a comparison of incompatible types, print the given marker, e.g. <error>, instead
+// of failing the whole template. The other actions are printed as usual, and the errors of
+// the failed actions are returned together once the template was executed. Errors of
+// range and end actions still fail the template. The receiver is returned for chaining.
+func (j *JSONPath) ContinueOnError(marker string) *JSONPath {
+	j.continueOnError = true
+	j.errorMarker = marker
+	return j
+}
+
+// continuedErrors returns the errors of the actions replaced by the error marker joined
+// into a single error, or nil if there were none
+func (j *JSONPath) continuedErrors() error {
+	return errors.Join(j.continuedErrs...)
+}
+
+// EmitNullForMissing makes a template like {.a.b.c}, which selects a single value by field
+// names and indexes only, print null instead of nothing or an error when the value is missing.
+// The receiver is returned for chaining.
+func (j *JSONPath) EmitNullForMissing(emit bool) *JSONPath {
+	j.emitNullForMissing = emit
+	return j
+}
+
+// SetMaxOutputBytes limits the output written by Execute to n bytes. Once the limit is
+// reached, Execute stops and returns ErrOutputTooLarge. A value of 0 removes the limit.
+func (j *JSONPath) SetMaxOutputBytes(n int) *JSONPath {
+	j.maxOutputBytes = n
+	return j
+}
+
+// limitedWriter writes at most remaining bytes to w and fails once they are exhausted
+type limitedWriter struct {
+	w         io.Writer
+	remaining int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) <= l.remaining {
+		n, err := l.w.Write(p)
+		l.remaining -= n
+		return n, err
+	}
+	n, err := l.w.Write(p[:l.remaining])
+	l.remaining -= n
+	if err != nil {
+		return n, err
+	}
+	return n, ErrOutputTooLarge
+}
+
+// BindVariable binds a value to the given name, which can then be referenced as $name
+// inside the template, e.g. {.items[?(@.region==$region)]}. The receiver is returned for chaining.
+func (j *JSONPath) BindVariable(name string, value interface{}) *JSONPath {
+	if j.variables == nil {
+		j.variables = map[string]interface{}{}
+	}
+	j.variables[name] = value
+	return j
+}
+
 // Parse parses the given template and returns an error.
 func (j *JSONPath) Parse(text string) error {
-	var err error
-	j.parser, err = Parse(j.name, text)
-	return err
+	p := j.newParser(j.name)
+	if err := p.Parse(text); err != nil {
+		j.parser = nil
+		return err
+	}
+	j.parser = p
+	j.predicates = &predicateCache{parsers: map[string]*Parser{}}
+	return nil
+}
+
+// newParser returns a parser with the parse settings of j
+func (j *JSONPath) newParser(name string) *Parser {
+	p := NewParser(name)
+	p.arities = j.functionArities()
+	p.globNames = j.globNames
+	p.strictEscapes = j.strictEscapes
+	if j.unknownFunctionHandler == nil {
+		p.functions = map[string]bool{}
+		for _, name := range j.RegisteredFunctions() {
+			p.functions[name] = true
+		}
+	}
+	return p
 }
 
 // Execute bounds data into template and writes the result.
 func (j *JSONPath) Execute(wr io.Writer, data interface{}) error {
-	fullResults, err := j.FindResults(data)
+	return j.execution().execute(wr, data)
+}
+
+// execute writes the results of the template, it must be called on an execution
+func (j *JSONPath) execute(wr io.Writer, data interface{}) error {
+	if j.maxOutputBytes > 0 {
+		wr = &limitedWriter{w: wr, remaining: j.maxOutputBytes}
+	}
+	if j.outputCSV {
+		return j.executeCSV(wr, data)
+	}
+	if j.outputYAML {
+		return j.executeYAML(wr, data)
+	}
+	fullResults, err := j.run(data)
 	if err != nil {
 		return err
 	}
 	for ix := range fullResults {
-		if err := j.PrintResults(wr, fullResults[ix]); err != nil {
+		if err := j.printLocated(wr, fullResults[ix]); err != nil {
 			return err
 		}
 	}
+	return j.continuedErrors()
+}
+
+// ExecuteLabeled behaves like Execute, but writes the query of every action before its
+// results, e.g. "[$.kind] List" for {.kind}, to tell which query printed what. Queries
+// inside a range start at @, the current value of the range.
+func (j *JSONPath) ExecuteLabeled(wr io.Writer, data interface{}) error {
+	exec := j.execution()
+	exec.labelQueries = true
+	return exec.execute(wr, data)
+}
+
+// canonicalQuery returns the query of an action starting at current, which is $ or @,
+// e.g. $.kind for .kind or @.kind. Other actions like function calls are returned unchanged.
+func canonicalQuery(text, current string) string {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "@" || strings.HasPrefix(text, "@.") || strings.HasPrefix(text, "@["):
+		return current + text[1:]
+	case strings.HasPrefix(text, ".") || strings.HasPrefix(text, "["):
+		return current + text
+	}
+	return text
+}
+
+// ExecuteOrNoResults behaves like Execute, but returns ErrNoResults if none of the
+// queries of the template matched anything. Plain text of the template is still written.
+func (j *JSONPath) ExecuteOrNoResults(wr io.Writer, data interface{}) error {
+	exec := j.execution()
+	if err := exec.execute(wr, data); err != nil {
+		return err
+	}
+	if exec.matched == 0 {
+		return ErrNoResults
+	}
 	return nil
 }
 
+// ExecuteStrict behaves like Execute, but decides for this execution only whether missing
+// keys are allowed, see AllowMissingKeys, so that a template can be shared by callers with
+// different needs.
+func (j *JSONPath) ExecuteStrict(wr io.Writer, data interface{}, allowMissing bool) error {
+	exec := j.execution()
+	exec.allowMissingKeys = allowMissing
+	return exec.execute(wr, data)
+}
+
+// Matches reports whether any query of the template matches something in data. The
+// evaluation stops at the first query with results and nothing is printed.
+func (j *JSONPath) Matches(data interface{}) (bool, error) {
+	exec := j.execution()
+	exec.existenceOnly = true
+	if _, err := exec.run(data); err != nil {
+		return false, err
+	}
+	return exec.matched > 0, nil
+}
+
+// ExecuteWith behaves like Execute, but binds the given variables for this execution only,
+// in addition to the ones bound by BindVariable. The template is not parsed again, and
+// concurrent calls with different variables do not affect each other.
+func (j *JSONPath) ExecuteWith(wr io.Writer, data interface{}, vars map[string]interface{}) error {
+	exec := j.execution()
+	exec.variables = make(map[string]interface{}, len(j.variables)+len(vars))
+	for name, value := range j.variables {
+		exec.variables[name] = value
+	}
+	for name, value := range vars {
+		exec.variables[name] = value
+	}
+	return exec.execute(wr, data)
+}
+
+// ExecuteEach calls fn for every value found by the queries of the template, in the order
+// in which Execute would print them, as soon as the results of a query are found rather than
+// after all queries ran. The text of the template is skipped. It stops at the first error
+// returned by fn and returns it.
+//
+// Queries ending in wildcards or recursive descent, e.g. {.items[*]} or {.spec..*}, pass
+// their matches to fn one at a time while walking the data. The results of other queries,
+// and of all queries if results are deduplicated, labeled, traced or errors are continued,
+// are collected per query first, so memory is only bounded by the largest of them.
+func (j *JSONPath) ExecuteEach(data interface{}, fn func(reflect.Value) error) error {
+	exec := j.execution()
+	exec.each = func(result located) error {
+		return fn(result.value)
+	}
+	err := exec.visit(data, func(results []located) error {
+		for _, r := range results {
+			if r.text {
+				continue
+			}
+			if err := fn(r.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return exec.continuedErrors()
+}
+
 func (j *JSONPath) FindResults(data interface{}) ([][]reflect.Value, error) {
+	fullResult, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]reflect.Value, 0, len(fullResult))
+	for _, r := range fullResult {
+		results = append(results, values(r))
+	}
+	return results, nil
+}
+
+// IndexedResult is a result together with its index in the array or slice containing it.
+type IndexedResult struct {
+	// Index is -1 if the result is not an element of an array or slice,
+	// e.g. a field of a struct or a value of a map.
+	Index int
+	Value reflect.Value
+}
+
+// ExecuteToValues returns the values found by all queries of the template, in the order in
+// which Execute would print them, including one value per iteration of a range. The text of
+// the template, e.g. the separators in {range .items[*]}{.name}{"\n"}{end}, is skipped.
+func (j *JSONPath) ExecuteToValues(data interface{}) ([]interface{}, error) {
+	fullResult, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, r := range fullResult {
+		for _, l := range r {
+			if !l.text {
+				results = append(results, l.value.Interface())
+			}
+		}
+	}
+	return results, nil
+}
+
+// FindResultsWithIndices behaves like FindResults, but also returns the index of every
+// result within its immediate parent array, e.g. 1 for {.items[1]}.
+func (j *JSONPath) FindResultsWithIndices(data interface{}) ([][]IndexedResult, error) {
+	fullResult, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]IndexedResult, 0, len(fullResult))
+	for _, r := range fullResult {
+		indexed := make([]IndexedResult, 0, len(r))
+		for _, l := range r {
+			index, ok := l.key.(int)
+			if !ok {
+				index = -1
+			}
+			indexed = append(indexed, IndexedResult{Index: index, Value: l.value})
+		}
+		results = append(results, indexed)
+	}
+	return results, nil
+}
+
+// KeyedResult is a result together with its key in the value containing it.
+type KeyedResult struct {
+	// Key is the index within an array or slice, or the map key or struct field name.
+	// It is empty for the data itself and for values computed by the template.
+	Key   string
+	Value reflect.Value
+}
+
+// FindResultsWithKeys returns the values found by all queries of the template, like
+// ExecuteToValues, together with their key in the immediate parent, e.g. the index of every
+// book with an isbn for {..book[?(@.isbn)]}, or the name of each entry for {.labels.*}.
+func (j *JSONPath) FindResultsWithKeys(data interface{}) ([]KeyedResult, error) {
+	fullResult, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	results := []KeyedResult{}
+	for _, r := range fullResult {
+		for _, l := range r {
+			if l.text {
+				continue
+			}
+			key := ""
+			if l.parent != nil {
+				key = fmt.Sprint(l.key)
+			}
+			results = append(results, KeyedResult{Key: key, Value: l.value})
+		}
+	}
+	return results, nil
+}
+
+// execution returns a copy of the template holding the state of a single execution,
+// so that concurrent executions of a parsed template do not affect each other
+func (j *JSONPath) execution() *JSONPath {
+	exec := *j
+	exec.beginRange, exec.inRange, exec.endRange, exec.lastEndNode = 0, 0, 0, nil
+	exec.matched = 0
+	exec.root = located{}
+	exec.tolerateMissing = false
+	exec.continuedErrs = nil
+	return &exec
+}
+
+// findLocatedResults finds the results of the template together with their locations
+func (j *JSONPath) findLocatedResults(data interface{}) ([][]located, error) {
+	exec := j.execution()
+	results, err := exec.run(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := exec.continuedErrors(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// run finds the results of the template together with their locations, it must be
+// called on an execution
+func (j *JSONPath) run(data interface{}) ([][]located, error) {
+	fullResult := [][]located{}
+	err := j.visit(data, func(results []located) error {
+		fullResult = append(fullResult, results)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fullResult, nil
+}
+
+// visit passes the results of every action of the template to fn as soon as they are
+// found, it must be called on an execution
+func (j *JSONPath) visit(data interface{}, fn func([]located) error) error {
 	if j.parser == nil {
-		return nil, fmt.Errorf("%s is an incomplete jsonpath template", j.name)
+		return fmt.Errorf("%s is an incomplete jsonpath template", j.name)
+	}
+	j.root = located{value: reflect.ValueOf(data), root: true}
+	if j.recorded != nil {
+		found := fn
+		fn = func(results []located) error {
+			j.recordResults(results)
+			return found(results)
+		}
 	}
+	return j.findResults(j.root, j.parser.Root.Nodes, fn)
+}
 
-	cur := []reflect.Value{reflect.ValueOf(data)}
-	nodes := j.parser.Root.Nodes
-	fullResult := [][]reflect.Value{}
+// findResults evaluates the given nodes of the template, recursing into range blocks,
+// and passes the results of every action to fn
+func (j *JSONPath) findResults(root located, nodes []Node, fn func([]located) error) error {
+	cur := []located{root}
 	for i := 0; i < len(nodes); i++ {
 		node := nodes[i]
-		results, err := j.walk(cur, node)
+		if prefix, suffix, ok := j.streamable(node); ok {
+			if err := j.streamResults(cur, prefix, suffix); err != nil {
+				return err
+			}
+			continue
+		}
+		singular := j.emitNullForMissing && isSingular(node)
+		results, err := j.walkSingular(cur, node, singular)
 		if err != nil {
-			return nil, err
+			if !j.continueOnError || isLet(node) || isRangeAction(node) {
+				return err
+			}
+			j.continuedErrs = append(j.continuedErrs, err)
+			marker := []located{{value: reflect.ValueOf(j.errorMarker), text: true}}
+			if err := fn(marker); err != nil {
+				return err
+			}
+			continue
 		}
 
 		// encounter an end node, break the current block
@@ -103,24 +713,28 @@ func (j *JSONPath) FindResults(data interface{}) ([][]reflect.Value, error) {
 		if j.beginRange > 0 {
 			j.beginRange--
 			j.inRange++
+			// variables bound by let inside the range are scoped to a single iteration
+			variables := j.variables
 			if len(results) > 0 {
 				for _, value := range results {
-					j.parser.Root.Nodes = nodes[i+1:]
-					nextResults, err := j.FindResults(value.Interface())
-					if err != nil {
-						return nil, err
+					j.variables = variables
+					value.value = reflect.ValueOf(value.value.Interface())
+					if err := j.findRangeResults(value, nodes, i, fn); err != nil {
+						return err
+					}
+					if j.existenceOnly && j.matched > 0 {
+						return nil
 					}
-					fullResult = append(fullResult, nextResults...)
 				}
 			} else {
 				// If the range has no results, we still need to process the nodes within the range
 				// so the position will advance to the end node
-				j.parser.Root.Nodes = nodes[i+1:]
-				_, err := j.FindResults(nil)
+				err := j.findRangeResults(located{value: reflect.ValueOf(nil)}, nodes, i, discard)
 				if err != nil {
-					return nil, err
+					return err
 				}
 			}
+			j.variables = variables
 			j.inRange--
 
 			// Fast forward to resume processing after the most recent end node that was encountered
@@ -132,30 +746,426 @@ func (j *JSONPath) FindResults(data interface{}) ([][]reflect.Value, error) {
 			}
 			continue
 		}
-		fullResult = append(fullResult, results)
+		if isLet(node) {
+			continue
+		}
+		if !isText(node) {
+			j.matched += len(results)
+			if j.existenceOnly && j.matched > 0 {
+				return fn(results)
+			}
+		}
+		if singular && len(results) == 0 {
+			results = []located{{value: reflect.Zero(interfaceType), missing: true}}
+		}
+		if j.deduplicate && !isText(node) {
+			results = deduplicated(results)
+		}
+		if list, ok := node.(*ListNode); ok && j.labelQueries && !isText(node) {
+			// queries inside a range are relative to the current value
+			current := "$"
+			if j.inRange > 0 {
+				current = "@"
+			}
+			label := fmt.Sprintf("[%s] ", canonicalQuery(list.text, current))
+			if err := fn([]located{{value: reflect.ValueOf(label), text: true}}); err != nil {
+				return err
+			}
+		}
+		if err := fn(results); err != nil {
+			return err
+		}
 	}
-	return fullResult, nil
+	return nil
+}
+
+// streamable splits the action into the nodes before its trailing wildcards and recursive
+// descents and those, if its results can be passed to each one at a time, see ExecuteEach
+func (j *JSONPath) streamable(node Node) ([]Node, []Node, bool) {
+	if j.each == nil || j.trace != nil || j.deduplicate || j.labelQueries || j.continueOnError || j.existenceOnly {
+		return nil, nil, false
+	}
+	list, ok := node.(*ListNode)
+	if !ok || isRangeAction(node) {
+		return nil, nil, false
+	}
+	k := len(list.Nodes)
+	for k > 0 {
+		switch list.Nodes[k-1].(type) {
+		case *WildcardNode, *RecursiveNode:
+			k--
+			continue
+		}
+		break
+	}
+	if k == len(list.Nodes) {
+		return nil, nil, false
+	}
+	return list.Nodes[:k], list.Nodes[k:], true
+}
+
+// streamResults walks the prefix nodes and passes every value found by the trailing
+// wildcards and recursive descents to each as soon as it is found
+func (j *JSONPath) streamResults(cur []located, prefix, suffix []Node) error {
+	var err error
+	for _, node := range prefix {
+		cur, err = j.walk(cur, node)
+		if err != nil {
+			return err
+		}
+	}
+	for _, in := range cur {
+		err := j.eachResult(in, suffix, func(result located) error {
+			j.matched++
+			return j.each(result)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachResult passes the values found by the wildcards and recursive descents of nodes
+// starting at the given value to fn, one at a time
+func (j *JSONPath) eachResult(in located, nodes []Node, fn func(located) error) error {
+	if len(nodes) == 0 {
+		return fn(in)
+	}
+	next := func(result located) error {
+		return j.eachResult(result, nodes[1:], fn)
+	}
+	if _, ok := nodes[0].(*RecursiveNode); ok {
+		return j.descendEach([]located{in}, map[containerKey]bool{}, 0, next)
+	}
+	for _, child := range j.evalChildren(in) {
+		if err := next(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard drops the results of the actions it is passed
+func discard([]located) error {
+	return nil
+}
+
+// findRangeResults finds the results of the body of the range starting at nodes[i] for a
+// single value. If range errors are skipped, a failing iteration has no results, so they
+// are only passed to fn once the iteration succeeded.
+func (j *JSONPath) findRangeResults(value located, nodes []Node, i int, fn func([]located) error) error {
+	if !j.skipRangeErrors {
+		return j.findResults(value, nodes[i+1:], fn)
+	}
+	beginRange, inRange, endRange := j.beginRange, j.inRange, j.endRange
+	iteration := [][]located{}
+	err := j.findResults(value, nodes[i+1:], func(results []located) error {
+		iteration = append(iteration, results)
+		return nil
+	})
+	if err != nil {
+		j.beginRange, j.inRange, j.endRange = beginRange, inRange, endRange
+		if end := rangeEnd(nodes, i); end >= 0 {
+			j.lastEndNode = &nodes[end]
+		}
+		return nil
+	}
+	for _, results := range iteration {
+		if err := fn(results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRangeAction reports whether the node starts or ends a range
+func isRangeAction(node Node) bool {
+	list, ok := node.(*ListNode)
+	if !ok || len(list.Nodes) == 0 {
+		return false
+	}
+	identifier, ok := list.Nodes[0].(*IdentifierNode)
+	return ok && (identifier.Name == "range" || identifier.Name == "end")
+}
+
+// rangeEnd returns the index of the end node of the range starting at nodes[i], or -1
+func rangeEnd(nodes []Node, i int) int {
+	depth := 0
+	for k := i + 1; k < len(nodes); k++ {
+		list, ok := nodes[k].(*ListNode)
+		if !ok || len(list.Nodes) == 0 {
+			continue
+		}
+		identifier, ok := list.Nodes[0].(*IdentifierNode)
+		if !ok {
+			continue
+		}
+		switch identifier.Name {
+		case "range":
+			depth++
+		case "end":
+			if depth == 0 {
+				return k
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// interfaceType is the type of the nil interface value found in place of missing values,
+// the same as a JSON null decoded into an interface{}
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// walkSingular walks the node, tolerating missing keys if it selects a single value
+func (j *JSONPath) walkSingular(cur []located, node Node, singular bool) ([]located, error) {
+	if !singular {
+		return j.walk(cur, node)
+	}
+	j.tolerateMissing = true
+	defer func() { j.tolerateMissing = false }()
+	return j.walk(cur, node)
+}
+
+// isSingular reports whether the node selects at most a single value, i.e. it only
+// consists of field names and single indexes
+func isSingular(node Node) bool {
+	list, ok := node.(*ListNode)
+	if !ok || len(list.Nodes) == 0 {
+		return false
+	}
+	for _, n := range list.Nodes {
+		switch n := n.(type) {
+		case *FieldNode:
+		case *ArrayNode:
+			if !n.Params[1].Derived {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// deduplicated returns the results without those deeply equal to an earlier one
+func deduplicated(results []located) []located {
+	kept := []located{}
+	seen := []interface{}{}
+	for _, r := range results {
+		if !r.value.IsValid() || !r.value.CanInterface() {
+			kept = append(kept, r)
+			continue
+		}
+		v := r.value.Interface()
+		if !containsEqual(seen, v) {
+			seen = append(seen, v)
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// isLet reports whether the node binds a variable, which has no results to print
+func isLet(node Node) bool {
+	list, ok := node.(*ListNode)
+	return ok && len(list.Nodes) == 1 && list.Nodes[0].Type() == NodeLet
+}
+
+// isText reports whether the node is plain or quoted text rather than a query
+func isText(node Node) bool {
+	if list, ok := node.(*ListNode); ok {
+		for _, n := range list.Nodes {
+			if n.Type() != NodeText {
+				return false
+			}
+		}
+		return true
+	}
+	return node.Type() == NodeText
 }
 
 // EnableJSONOutput changes the PrintResults behavior to return a JSON array of results
 func (j *JSONPath) EnableJSONOutput(v bool) {
 	j.outputJSON = v
+	j.condensedJSON = false
+	if v {
+		j.outputCSV = false
+		j.outputYAML = false
+	}
+}
+
+// UnwrapSingleResult changes the JSON output to print a query with exactly one result as
+// that result rather than as an array holding it.
+func (j *JSONPath) UnwrapSingleResult(unwrap bool) {
+	j.unwrapSingleResult = unwrap
+}
+
+// PreferStringer changes the PrintResults behavior to print values implementing error or
+// fmt.Stringer by their Error or String method even if they would otherwise be printed as
+// JSON, e.g. structs with exported fields.
+func (j *JSONPath) PreferStringer(prefer bool) {
+	j.preferStringer = prefer
+}
+
+// OutputFormat selects how PrintResults prints the results of a query.
+type OutputFormat int
+
+const (
+	// LegacyOutput prints scalars as text and other values as JSON, separated by spaces.
+	LegacyOutput OutputFormat = iota
+	// JSONOutput prints an indented JSON array of the results, see SetIndent.
+	JSONOutput
+	// CondensedJSONOutput prints a JSON array of the results on a single line.
+	CondensedJSONOutput
+	// CSVOutput makes Execute write a CSV row for every result, see EnableCSVOutput.
+	CSVOutput
+	// YAMLOutput prints every result as a YAML document, see EnableYAMLOutput.
+	YAMLOutput
+)
+
+// defaultIndent is the indent of JSONOutput unless changed with SetIndent
+const defaultIndent = "    "
+
+// SetOutputFormat changes the PrintResults behavior to the given format.
+// EnableJSONOutput(true) is equivalent to SetOutputFormat(JSONOutput).
+func (j *JSONPath) SetOutputFormat(format OutputFormat) {
+	j.outputJSON = format == JSONOutput || format == CondensedJSONOutput
+	j.condensedJSON = format == CondensedJSONOutput
+	j.outputCSV = format == CSVOutput
+	j.outputYAML = format == YAMLOutput
+}
+
+// SetIndent sets the string used for each level of indentation by JSONOutput,
+// four spaces by default.
+func (j *JSONPath) SetIndent(indent string) {
+	j.indent = indent
+}
+
+// EnableTypedOutput changes the PrintResults behavior to prefix every result with its
+// JSON type, e.g. string:foo or number:5, which helps debugging queries with mixed results.
+func (j *JSONPath) EnableTypedOutput(v bool) {
+	j.typedOutput = v
+}
+
+var (
+	floatFormatRex = regexp.MustCompile(`^%[-+# 0]*[0-9]*(\.[0-9]+)?[eEfFgG]$`)
+	intFormatRex   = regexp.MustCompile(`^%[-+# 0]*[0-9]*[bdoxX]$`)
+)
+
+// SetFloatFormat sets the fmt verb used to print floating point results, e.g. %.2f.
+// An error is returned if the format is not a single floating point verb.
+func (j *JSONPath) SetFloatFormat(format string) error {
+	if !floatFormatRex.MatchString(format) {
+		return fmt.Errorf("invalid float format %q", format)
+	}
+	j.floatFormat = format
+	return nil
+}
+
+// MustSetFloatFormat is like SetFloatFormat but panics if the format is invalid.
+// The receiver is returned for chaining.
+func (j *JSONPath) MustSetFloatFormat(format string) *JSONPath {
+	if err := j.SetFloatFormat(format); err != nil {
+		panic(err)
+	}
+	return j
+}
+
+// SetIntFormat sets the fmt verb used to print integer results, e.g. %05d.
+// An error is returned if the format is not a single integer verb.
+func (j *JSONPath) SetIntFormat(format string) error {
+	if !intFormatRex.MatchString(format) {
+		return fmt.Errorf("invalid int format %q", format)
+	}
+	j.intFormat = format
+	return nil
+}
+
+// OmitEmptyFields changes the PrintResults behavior to leave out struct fields holding
+// their zero value when printing objects, as if all fields were tagged with omitempty.
+func (j *JSONPath) OmitEmptyFields(omit bool) {
+	j.omitEmptyFields = omit
+}
+
+// FlattenToScalars changes the PrintResults behavior to print only the scalar leaves of
+// the results, recursing into arrays, slices, maps and structs, joined by the given delimiter.
+// Map entries are visited in the order of their sorted keys.
+func (j *JSONPath) FlattenToScalars(delim string) {
+	j.flattenScalars = true
+	j.flattenDelimiter = delim
+}
+
+// printLocated writes the results of an action into writer, the text of the template is
+// printed without the type prefix of EnableTypedOutput
+func (j *JSONPath) printLocated(wr io.Writer, results []located) error {
+	if len(results) == 1 && results[0].missing && !j.outputJSON && !j.outputYAML {
+		// printed as null rather than as the <nil> of a JSON null in the data
+		text := "null"
+		if j.typedOutput {
+			text = "null:" + text
+		}
+		_, err := io.WriteString(wr, text)
+		return err
+	}
+	if j.typedOutput && isTextResult(results) {
+		untyped := *j
+		untyped.typedOutput = false
+		return untyped.PrintResults(wr, values(results))
+	}
+	return j.PrintResults(wr, values(results))
+}
+
+// isTextResult reports whether the results are text of the template rather than values
+// found by a query
+func isTextResult(results []located) bool {
+	for _, r := range results {
+		if !r.text {
+			return false
+		}
+	}
+	return len(results) > 0
 }
 
 // PrintResults writes the results into writer
 func (j *JSONPath) PrintResults(wr io.Writer, results []reflect.Value) error {
+	if j.flattenScalars {
+		return j.printFlattened(wr, results)
+	}
+	if j.outputYAML {
+		return j.printYAML(wr, results)
+	}
 	if j.outputJSON {
 		// convert the []reflect.Value to something that json
 		// will be able to marshal
 		r := make([]interface{}, 0, len(results))
 		for i := range results {
+			text, ok, err := textValue(results[i], j.preferStringer)
+			if err != nil {
+				return err
+			}
+			if ok {
+				r = append(r, text)
+				continue
+			}
 			r = append(r, results[i].Interface())
 		}
-		results = []reflect.Value{reflect.ValueOf(r)}
+		if j.unwrapSingleResult && len(r) == 1 {
+			// the element of r keeps a nil result printable
+			results = []reflect.Value{reflect.ValueOf(r).Index(0)}
+		} else {
+			results = []reflect.Value{reflect.ValueOf(r)}
+		}
 	}
 	for i, r := range results {
 		var text []byte
 		var err error
+		if s, ok, err := textValue(r, j.preferStringer); err != nil {
+			return err
+		} else if ok {
+			r = reflect.ValueOf(s)
+		}
 		outputJSON := true
 		kind := r.Kind()
 		if kind == reflect.Interface {
@@ -171,11 +1181,18 @@ func (j *JSONPath) PrintResults(wr io.Writer, results []reflect.Value) error {
 		}
 		switch {
 		case outputJSON || j.outputJSON:
-			if j.outputJSON {
-				text, err = json.MarshalIndent(r.Interface(), "", "    ")
+			v := r.Interface()
+			if j.omitEmptyFields {
+				v = withoutEmptyFields(r)
+			}
+			if j.outputJSON && j.condensedJSON {
+				text, err = json.Marshal(v)
+				text = append(text, '\n')
+			} else if j.outputJSON {
+				text, err = json.MarshalIndent(v, "", j.indent)
 				text = append(text, '\n')
 			} else {
-				text, err = json.Marshal(r.Interface())
+				text, err = json.Marshal(v)
 			}
 		default:
 			text, err = j.evalToText(r)
@@ -183,25 +1200,202 @@ func (j *JSONPath) PrintResults(wr io.Writer, results []reflect.Value) error {
 		if err != nil {
 			return err
 		}
-		if i != len(results)-1 {
-			text = append(text, ' ')
+		if j.typedOutput && !j.outputJSON {
+			text = append([]byte(jsonType(r)+":"), text...)
+		}
+		if i != len(results)-1 {
+			text = append(text, ' ')
+		}
+		if _, err = wr.Write(text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// structFields is a struct without its empty fields, marshaled as a JSON object
+// with the fields in their declared order
+type structFields []structField
+
+type structField struct {
+	name  string
+	value interface{}
+}
+
+func (s structFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range s {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// withoutEmptyFields returns the value with all empty struct fields removed, see OmitEmptyFields.
+// Values which marshal themselves are returned unchanged.
+func withoutEmptyFields(value reflect.Value) interface{} {
+	value, isNil := template.Indirect(value)
+	if isNil || !value.IsValid() {
+		return nil
+	}
+	if !value.CanInterface() {
+		return nil
+	}
+	if _, ok := value.Interface().(json.Marshaler); ok {
+		return value.Interface()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return appendNonEmptyFields(structFields{}, value)
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Interface()
+		}
+		result := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			result = append(result, withoutEmptyFields(value.Index(i)))
+		}
+		return result
+	case reflect.Map:
+		result := make(map[string]interface{}, value.Len())
+		for _, key := range value.MapKeys() {
+			result[fmt.Sprint(key.Interface())] = withoutEmptyFields(value.MapIndex(key))
+		}
+		return result
+	}
+	return value.Interface()
+}
+
+// appendNonEmptyFields appends the exported non-empty fields of the struct, including the
+// fields of embedded structs
+func appendNonEmptyFields(fields structFields, value reflect.Value) structFields {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		field := value.Field(i)
+		if f.Tag.Get("json") == "-" || field.IsZero() {
+			continue
+		}
+		if f.Anonymous && strings.Split(f.Tag.Get("json"), ",")[0] == "" {
+			if embedded, isNil := template.Indirect(field); !isNil && embedded.Kind() == reflect.Struct {
+				fields = appendNonEmptyFields(fields, embedded)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fields = append(fields, structField{name: fieldName(f), value: withoutEmptyFields(field)})
+	}
+	return fields
+}
+
+// printFlattened writes the scalar leaves of the results into writer, joined by the flatten delimiter
+func (j *JSONPath) printFlattened(wr io.Writer, results []reflect.Value) error {
+	leaves := []reflect.Value{}
+	for _, r := range results {
+		leaves = collectLeaves(leaves, r)
+	}
+	texts := make([]string, 0, len(leaves))
+	for _, leaf := range leaves {
+		text, err := j.evalToText(leaf)
+		if err != nil {
+			return err
+		}
+		texts = append(texts, string(text))
+	}
+	_, err := io.WriteString(wr, strings.Join(texts, j.flattenDelimiter))
+	return err
+}
+
+// collectLeaves appends all scalar values found in the given value to leaves
+func collectLeaves(leaves []reflect.Value, value reflect.Value) []reflect.Value {
+	value, isNil := template.Indirect(value)
+	if isNil {
+		return append(leaves, value)
+	}
+	switch value.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			leaves = collectLeaves(leaves, value.Index(i))
 		}
-		if _, err = wr.Write(text); err != nil {
-			return err
+	case reflect.Map:
+		for _, key := range sortedMapKeys(value) {
+			leaves = collectLeaves(leaves, value.MapIndex(key))
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				leaves = collectLeaves(leaves, value.Field(i))
+			}
 		}
+	default:
+		leaves = append(leaves, value)
 	}
+	return leaves
+}
 
-	return nil
+// sortedMapKeys returns the keys of the map ordered numerically if they are numbers and
+// by their printed form otherwise, numbers coming first in maps with keys of both kinds
+func sortedMapKeys(value reflect.Value) []reflect.Value {
+	keys := value.MapKeys()
+	sort.Slice(keys, func(a, b int) bool {
+		left, leftIsNumber := numericKey(keys[a])
+		right, rightIsNumber := numericKey(keys[b])
+		switch {
+		case leftIsNumber && rightIsNumber && left != right:
+			return left < right
+		case leftIsNumber != rightIsNumber:
+			return leftIsNumber
+		}
+		return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface())
+	})
+	return keys
+}
 
+// numericKey returns the value of a map key holding a number
+func numericKey(key reflect.Value) (float64, bool) {
+	key, isNil := template.Indirect(key)
+	if isNil {
+		return 0, false
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(key.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(key.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return key.Float(), true
+	}
+	return 0, false
 }
 
 // walk visits tree rooted at the given node in DFS order
-func (j *JSONPath) walk(value []reflect.Value, node Node) ([]reflect.Value, error) {
+func (j *JSONPath) walk(value []located, node Node) (results []located, err error) {
+	if j.trace != nil {
+		defer func() { j.traceNode(node, value, results, err) }()
+	}
 	switch node := node.(type) {
 	case *ListNode:
 		return j.evalList(value, node)
 	case *TextNode:
-		return []reflect.Value{reflect.ValueOf(node.Text)}, nil
+		return []located{{value: reflect.ValueOf(node.Text), text: true}}, nil
 	case *FieldNode:
 		return j.evalField(value, node)
 	case *ArrayNode:
@@ -222,40 +1416,133 @@ func (j *JSONPath) walk(value []reflect.Value, node Node) ([]reflect.Value, erro
 		return j.evalUnion(value, node)
 	case *IdentifierNode:
 		return j.evalIdentifier(value, node)
+	case *FunctionNode:
+		return j.evalFunction(value, node)
+	case *VariableNode:
+		return j.evalVariable(value, node)
+	case *LetNode:
+		return j.evalLet(value, node)
+	case *ProjectNode:
+		return j.evalProject(value, node)
+	case *KeyNode:
+		return j.evalKey(value, node)
+	case *ParentNode:
+		return j.evalParent(value, node)
+	case *GlobNode:
+		return j.evalGlob(value, node)
+	case *IncludeNode:
+		return j.evalInclude(value, node)
+	case *RootNode:
+		return []located{j.root}, nil
 	default:
 		return value, fmt.Errorf("unexpected Node %v", node)
 	}
 }
 
 // evalInt evaluates IntNode
-func (j *JSONPath) evalInt(input []reflect.Value, node *IntNode) ([]reflect.Value, error) {
-	result := make([]reflect.Value, len(input))
+func (j *JSONPath) evalInt(input []located, node *IntNode) ([]located, error) {
+	result := make([]located, len(input))
 	for i := range input {
-		result[i] = reflect.ValueOf(node.Value)
+		result[i] = located{value: reflect.ValueOf(node.Value)}
 	}
 	return result, nil
 }
 
 // evalFloat evaluates FloatNode
-func (j *JSONPath) evalFloat(input []reflect.Value, node *FloatNode) ([]reflect.Value, error) {
-	result := make([]reflect.Value, len(input))
+func (j *JSONPath) evalFloat(input []located, node *FloatNode) ([]located, error) {
+	result := make([]located, len(input))
 	for i := range input {
-		result[i] = reflect.ValueOf(node.Value)
+		result[i] = located{value: reflect.ValueOf(node.Value)}
 	}
 	return result, nil
 }
 
 // evalBool evaluates BoolNode
-func (j *JSONPath) evalBool(input []reflect.Value, node *BoolNode) ([]reflect.Value, error) {
-	result := make([]reflect.Value, len(input))
+func (j *JSONPath) evalBool(input []located, node *BoolNode) ([]located, error) {
+	result := make([]located, len(input))
 	for i := range input {
-		result[i] = reflect.ValueOf(node.Value)
+		result[i] = located{value: reflect.ValueOf(node.Value)}
+	}
+	return result, nil
+}
+
+// evalVariable evaluates VariableNode
+func (j *JSONPath) evalVariable(input []located, node *VariableNode) ([]located, error) {
+	variable, ok := j.variables[node.Name]
+	if !ok {
+		return input, fmt.Errorf("variable %s is not bound", node.Name)
+	}
+	result := []located{}
+	if variable == nil {
+		return result, nil
+	}
+	for range input {
+		result = append(result, located{value: reflect.ValueOf(variable)})
+	}
+	return result, nil
+}
+
+// collapse returns nil for no results, the only result, or a slice of several results
+func collapse(results []located) interface{} {
+	switch len(results) {
+	case 0:
+		return nil
+	case 1:
+		return results[0].value.Interface()
+	}
+	all := make([]interface{}, 0, len(results))
+	for _, r := range results {
+		all = append(all, r.value.Interface())
+	}
+	return all
+}
+
+// evalLet evaluates LetNode, binding the results of its value for the rest of the
+// execution, or of the range iteration it is in, see collapse.
+func (j *JSONPath) evalLet(input []located, node *LetNode) ([]located, error) {
+	results, err := j.evalList(input, node.Value)
+	if err != nil {
+		return input, err
+	}
+	value := collapse(results)
+	// the variables of the template must not be modified by an execution
+	variables := make(map[string]interface{}, len(j.variables)+1)
+	for name, v := range j.variables {
+		variables[name] = v
+	}
+	variables[node.Name] = value
+	j.variables = variables
+	return []located{}, nil
+}
+
+// evalKey evaluates KeyNode, returning the map key or array index of every value
+func (j *JSONPath) evalKey(input []located, node *KeyNode) ([]located, error) {
+	result := []located{}
+	for _, in := range input {
+		if in.key != nil {
+			result = append(result, located{value: reflect.ValueOf(in.key)})
+		}
+	}
+	return result, nil
+}
+
+// evalParent evaluates ParentNode, returning the value containing every value once, e.g.
+// the array of all matching elements for {.items[?(@.ready)]^}. The data itself and values
+// which are not part of it have no parent.
+func (j *JSONPath) evalParent(input []located, node *ParentNode) ([]located, error) {
+	result := []located{}
+	seen := map[*located]bool{}
+	for _, in := range input {
+		if in.parent != nil && !seen[in.parent] {
+			seen[in.parent] = true
+			result = append(result, *in.parent)
+		}
 	}
 	return result, nil
 }
 
 // evalList evaluates ListNode
-func (j *JSONPath) evalList(value []reflect.Value, node *ListNode) ([]reflect.Value, error) {
+func (j *JSONPath) evalList(value []located, node *ListNode) ([]located, error) {
 	var err error
 	curValue := value
 	for _, node := range node.Nodes {
@@ -268,8 +1555,8 @@ func (j *JSONPath) evalList(value []reflect.Value, node *ListNode) ([]reflect.Va
 }
 
 // evalIdentifier evaluates IdentifierNode
-func (j *JSONPath) evalIdentifier(input []reflect.Value, node *IdentifierNode) ([]reflect.Value, error) {
-	results := []reflect.Value{}
+func (j *JSONPath) evalIdentifier(input []located, node *IdentifierNode) ([]located, error) {
+	results := []located{}
 	switch node.Name {
 	case "range":
 		j.beginRange++
@@ -280,18 +1567,32 @@ func (j *JSONPath) evalIdentifier(input []reflect.Value, node *IdentifierNode) (
 		} else {
 			return results, fmt.Errorf("not in range, nothing to end")
 		}
+	case "index":
+		// the index of the current element within its array, e.g. {[?(@index<2)]}
+		for _, in := range input {
+			if index, ok := in.key.(int); ok {
+				results = append(results, located{value: reflect.ValueOf(index)})
+			}
+		}
 	default:
-		return input, fmt.Errorf("unrecognized identifier %v", node.Name)
+		re, ok := j.regexps[node.Name]
+		if !ok {
+			return input, fmt.Errorf("unrecognized identifier %v", node.Name)
+		}
+		for range input {
+			results = append(results, located{value: reflect.ValueOf(re)})
+		}
 	}
 	return results, nil
 }
 
 // evalArray evaluates ArrayNode
-func (j *JSONPath) evalArray(input []reflect.Value, node *ArrayNode) ([]reflect.Value, error) {
-	result := []reflect.Value{}
-	for _, value := range input {
+func (j *JSONPath) evalArray(input []located, node *ArrayNode) ([]located, error) {
+	result := []located{}
+	for _, in := range input {
+		parent := in
 
-		value, isNil := template.Indirect(value)
+		value, isNil := template.Indirect(in.value)
 		if isNil {
 			continue
 		}
@@ -299,6 +1600,22 @@ func (j *JSONPath) evalArray(input []reflect.Value, node *ArrayNode) ([]reflect.
 			return input, fmt.Errorf("%v is not array or slice", value.Type())
 		}
 		params := node.Params
+		step := 1
+		if params[2].Known {
+			if params[2].Value == 0 {
+				// a step of 0 selects no elements
+				continue
+			}
+			step = params[2].Value
+		}
+		if step < 0 {
+			reversed, err := j.evalReverseSlice(&parent, value, params, step)
+			if err != nil {
+				return input, err
+			}
+			result = append(result, reversed...)
+			continue
+		}
 		if !params[0].Known {
 			params[0].Value = 0
 		}
@@ -315,6 +1632,9 @@ func (j *JSONPath) evalArray(input []reflect.Value, node *ArrayNode) ([]reflect.
 		sliceLength := value.Len()
 		if params[1].Value != params[0].Value { // if you're requesting zero elements, allow it through.
 			if params[0].Value >= sliceLength || params[0].Value < 0 {
+				if j.tolerateMissing {
+					continue
+				}
 				return input, fmt.Errorf("array index out of bounds: index %d, length %d", params[0].Value, sliceLength)
 			}
 			if params[1].Value > sliceLength || params[1].Value < 0 {
@@ -327,25 +1647,54 @@ func (j *JSONPath) evalArray(input []reflect.Value, node *ArrayNode) ([]reflect.
 			return result, nil
 		}
 
-		value = value.Slice(params[0].Value, params[1].Value)
+		for i := params[0].Value; i < params[1].Value; i += step {
+			result = append(result, located{value: value.Index(i), parent: &parent, key: i})
+		}
+	}
+	return result, nil
+}
 
-		step := 1
-		if params[2].Known {
-			if params[2].Value <= 0 {
-				return input, fmt.Errorf("step must be > 0")
-			}
-			step = params[2].Value
+// evalReverseSlice selects the elements of an array or slice for a negative step,
+// walking from the start index down to, but excluding, the end index. The start index
+// defaults to the last element and the end index to before the first element.
+func (j *JSONPath) evalReverseSlice(parent *located, value reflect.Value, params [3]ParamsEntry, step int) ([]located, error) {
+	sliceLength := value.Len()
+	start, end := sliceLength-1, -1
+	if params[0].Known {
+		start = params[0].Value
+		if start < 0 {
+			start += sliceLength
 		}
-		for i := 0; i < value.Len(); i += step {
-			result = append(result, value.Index(i))
+	}
+	if params[1].Known {
+		end = params[1].Value
+		if end < 0 {
+			end += sliceLength
 		}
 	}
+	if start == end {
+		return nil, nil
+	}
+	if start >= sliceLength || start < 0 {
+		return nil, fmt.Errorf("array index out of bounds: index %d, length %d", start, sliceLength)
+	}
+	// an end index of -1 after normalization means "up to and including the first element"
+	if end >= sliceLength || end < -1 {
+		return nil, fmt.Errorf("array index out of bounds: index %d, length %d", end+1, sliceLength)
+	}
+	if start < end {
+		return nil, fmt.Errorf("starting index %d is less than ending index %d", start, end)
+	}
+	result := []located{}
+	for i := start; i > end; i += step {
+		result = append(result, located{value: value.Index(i), parent: parent, key: i})
+	}
 	return result, nil
 }
 
 // evalUnion evaluates UnionNode
-func (j *JSONPath) evalUnion(input []reflect.Value, node *UnionNode) ([]reflect.Value, error) {
-	result := []reflect.Value{}
+func (j *JSONPath) evalUnion(input []located, node *UnionNode) ([]located, error) {
+	result := []located{}
 	for _, listNode := range node.Nodes {
 		temp, err := j.evalList(input, listNode)
 		if err != nil {
@@ -356,9 +1705,11 @@ func (j *JSONPath) evalUnion(input []reflect.Value, node *UnionNode) ([]reflect.
 	return result, nil
 }
 
+// findFieldInValue returns the field of the struct whose json tag, or otherwise Go name,
+// is the name of the node, looking into inline and embedded structs as well
 func (j *JSONPath) findFieldInValue(value *reflect.Value, node *FieldNode) (reflect.Value, error) {
 	t := value.Type()
-	var inlineValue *reflect.Value
+	var inlineValues []reflect.Value
 	for ix := 0; ix < t.NumField(); ix++ {
 		f := t.Field(ix)
 		jsonTag := f.Tag.Get("json")
@@ -370,35 +1721,80 @@ func (j *JSONPath) findFieldInValue(value *reflect.Value, node *FieldNode) (refl
 			return value.Field(ix), nil
 		}
 		if len(parts[0]) == 0 {
-			val := value.Field(ix)
-			inlineValue = &val
+			inlineValues = append(inlineValues, value.Field(ix))
 		}
 	}
-	if inlineValue != nil {
-		if inlineValue.Kind() == reflect.Struct {
-			// handle 'inline'
-			match, err := j.findFieldInValue(inlineValue, node)
-			if err != nil {
-				return reflect.Value{}, err
-			}
-			if match.IsValid() {
-				return match, nil
-			}
+	for _, inlineValue := range inlineValues {
+		// handle 'inline' and embedded structs, skipping nil pointers
+		inlineValue, isNil := template.Indirect(inlineValue)
+		if isNil || inlineValue.Kind() != reflect.Struct {
+			continue
+		}
+		match, err := j.findFieldInValue(&inlineValue, node)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if match.IsValid() {
+			return match, nil
+		}
+	}
+	f, ok := t.FieldByName(node.Value)
+	if !ok {
+		return reflect.Value{}, nil
+	}
+	// promoted fields of nil embedded pointers are missing
+	match, err := value.FieldByIndexErr(f.Index)
+	if err != nil {
+		return reflect.Value{}, nil
+	}
+	return match, nil
+}
+
+// fieldMapKey returns the key of the given type named by a field, e.g. 1 of {.codes.1} for a
+// map[int]string. An invalid value is returned for names which cannot be such a key.
+func fieldMapKey(name string, keyType reflect.Type) (reflect.Value, error) {
+	nameValue := reflect.ValueOf(name)
+	key := reflect.New(keyType).Elem()
+	switch keyType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(name, 10, keyType.Bits())
+		if err != nil {
+			return reflect.Value{}, nil
+		}
+		key.SetInt(i)
+		return key, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(name, 10, keyType.Bits())
+		if err != nil {
+			return reflect.Value{}, nil
 		}
+		key.SetUint(u)
+		return key, nil
+	}
+	// node value type must be convertible to map key type
+	if !nameValue.Type().ConvertibleTo(keyType) {
+		return reflect.Value{}, fmt.Errorf("%s is not convertible to %s", nameValue, keyType)
 	}
-	return value.FieldByName(node.Value), nil
+	return nameValue.Convert(keyType), nil
 }
 
 // evalField evaluates field of struct or key of map.
-func (j *JSONPath) evalField(input []reflect.Value, node *FieldNode) ([]reflect.Value, error) {
-	results := []reflect.Value{}
+func (j *JSONPath) evalField(input []located, node *FieldNode) ([]located, error) {
+	results := []located{}
 	// If there's no input, there's no output
 	if len(input) == 0 {
 		return results, nil
 	}
-	for _, value := range input {
+	for _, in := range input {
+		parent := in
 		var result reflect.Value
-		value, isNil := template.Indirect(value)
+		if it, ok := asNodeIterator(in.value); ok {
+			if child, found := it.Get(node.Value); found {
+				results = append(results, located{value: reflect.ValueOf(child), parent: &parent, key: node.Value})
+			}
+			continue
+		}
+		value, isNil := template.Indirect(in.value)
 		if isNil {
 			continue
 		}
@@ -409,20 +1805,20 @@ func (j *JSONPath) evalField(input []reflect.Value, node *FieldNode) ([]reflect.
 				return nil, err
 			}
 		} else if value.Kind() == reflect.Map {
-			mapKeyType := value.Type().Key()
-			nodeValue := reflect.ValueOf(node.Value)
-			// node value type must be convertible to map key type
-			if !nodeValue.Type().ConvertibleTo(mapKeyType) {
-				return results, fmt.Errorf("%s is not convertible to %s", nodeValue, mapKeyType)
+			key, err := fieldMapKey(node.Value, value.Type().Key())
+			if err != nil {
+				return results, err
+			}
+			if key.IsValid() {
+				result = value.MapIndex(key)
 			}
-			result = value.MapIndex(nodeValue.Convert(mapKeyType))
 		}
 		if result.IsValid() {
-			results = append(results, result)
+			results = append(results, located{value: result, parent: &parent, key: node.Value})
 		}
 	}
 	if len(results) == 0 {
-		if j.allowMissingKeys {
+		if j.allowMissingKeys || j.tolerateMissing {
 			return results, nil
 		}
 		return results, fmt.Errorf("%s is not found", node.Value)
@@ -430,27 +1826,60 @@ func (j *JSONPath) evalField(input []reflect.Value, node *FieldNode) ([]reflect.
 	return results, nil
 }
 
-// evalWildcard extracts all contents of the given value
-func (j *JSONPath) evalWildcard(input []reflect.Value, node *WildcardNode) ([]reflect.Value, error) {
-	results := []reflect.Value{}
-	for _, value := range input {
-		value, isNil := template.Indirect(value)
-		if isNil {
-			continue
-		}
+// evalChildren returns all contents of the given value together with their locations
+func (j *JSONPath) evalChildren(in located) []located {
+	results := []located{}
+	parent := in
+	if it, ok := asNodeIterator(in.value); ok {
+		return iteratorChildren(&parent, it)
+	}
+	value, isNil := template.Indirect(in.value)
+	if isNil {
+		return results
+	}
 
-		kind := value.Kind()
-		if kind == reflect.Struct {
-			for i := 0; i < value.NumField(); i++ {
-				results = append(results, value.Field(i))
-			}
-		} else if kind == reflect.Map {
-			for _, key := range value.MapKeys() {
-				results = append(results, value.MapIndex(key))
+	kind := value.Kind()
+	if kind == reflect.Struct {
+		for i := 0; i < value.NumField(); i++ {
+			f := value.Type().Field(i)
+			if j.exportedOnly && (!f.IsExported() || f.Tag.Get("json") == "-") {
+				continue
 			}
-		} else if kind == reflect.Array || kind == reflect.Slice || kind == reflect.String {
-			for i := 0; i < value.Len(); i++ {
-				results = append(results, value.Index(i))
+			results = append(results, located{value: value.Field(i), parent: &parent, key: fieldName(f)})
+		}
+	} else if kind == reflect.Map {
+		mapKeys := value.MapKeys()
+		if j.sortMapKeys {
+			mapKeys = sortedMapKeys(value)
+		}
+		for _, key := range mapKeys {
+			results = append(results, located{value: value.MapIndex(key), parent: &parent, key: fmt.Sprint(key.Interface())})
+		}
+	} else if kind == reflect.Array || kind == reflect.Slice || kind == reflect.String {
+		for i := 0; i < value.Len(); i++ {
+			results = append(results, located{value: value.Index(i), parent: &parent, key: i})
+		}
+	}
+	return results
+}
+
+// evalWildcard extracts all contents of the given value
+func (j *JSONPath) evalWildcard(input []located, node *WildcardNode) ([]located, error) {
+	results := []located{}
+	for _, in := range input {
+		results = append(results, j.evalChildren(in)...)
+	}
+	return results, nil
+}
+
+// evalGlob evaluates GlobNode, returning the children of maps and structs whose names
+// match the pattern
+func (j *JSONPath) evalGlob(input []located, node *GlobNode) ([]located, error) {
+	results := []located{}
+	for _, in := range input {
+		for _, child := range j.evalChildren(in) {
+			if name, ok := child.key.(string); ok && node.re.MatchString(name) {
+				results = append(results, child)
 			}
 		}
 	}
@@ -458,58 +1887,130 @@ func (j *JSONPath) evalWildcard(input []reflect.Value, node *WildcardNode) ([]re
 }
 
 // evalRecursive visits the given value recursively and pushes all of them to result
-func (j *JSONPath) evalRecursive(input []reflect.Value, node *RecursiveNode) ([]reflect.Value, error) {
-	result := []reflect.Value{}
-	for _, value := range input {
-		results := []reflect.Value{}
-		value, isNil := template.Indirect(value)
-		if isNil {
-			continue
+func (j *JSONPath) evalRecursive(input []located, node *RecursiveNode) ([]located, error) {
+	return j.descend(input, map[containerKey]bool{}, 0)
+}
+
+// containerKey identifies a pointer, map or slice by the memory it refers to
+type containerKey struct {
+	t   reflect.Type
+	ptr uintptr
+	len int
+}
+
+// containerKeyOf returns the key of the first pointer, map or slice found by following interfaces
+func containerKeyOf(value reflect.Value) (containerKey, bool) {
+	for value.Kind() == reflect.Interface && !value.IsNil() {
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if !value.IsNil() {
+			return containerKey{t: value.Type(), ptr: value.Pointer()}, true
+		}
+	case reflect.Slice:
+		if !value.IsNil() {
+			return containerKey{t: value.Type(), ptr: value.Pointer(), len: value.Len()}, true
 		}
+	}
+	return containerKey{}, false
+}
+
+// descend visits the given values recursively, ancestors holds the containers on the
+// path to them so that cyclic data is not descended into forever, depth is the number of
+// levels already descended
+func (j *JSONPath) descend(input []located, ancestors map[containerKey]bool, depth int) ([]located, error) {
+	result := []located{}
+	err := j.descendEach(input, ancestors, depth, func(in located) error {
+		result = append(result, in)
+		return nil
+	})
+	return result, err
+}
 
-		kind := value.Kind()
-		if kind == reflect.Struct {
-			for i := 0; i < value.NumField(); i++ {
-				results = append(results, value.Field(i))
+// descendEach is descend passing the values to fn one at a time
+func (j *JSONPath) descendEach(input []located, ancestors map[containerKey]bool, depth int, fn func(located) error) error {
+	for _, in := range input {
+		key, isContainer := containerKeyOf(in.value)
+		if isContainer && ancestors[key] {
+			if j.errorOnCycles {
+				return fmt.Errorf("recursive descent found a cycle at %v", in.value.Type())
 			}
-		} else if kind == reflect.Map {
-			for _, key := range value.MapKeys() {
-				results = append(results, value.MapIndex(key))
+			continue
+		}
+		children := j.evalChildren(in)
+		if len(children) != 0 {
+			value, _ := template.Indirect(in.value)
+			in.value = value
+			if err := fn(in); err != nil {
+				return err
 			}
-		} else if kind == reflect.Array || kind == reflect.Slice || kind == reflect.String {
-			for i := 0; i < value.Len(); i++ {
-				results = append(results, value.Index(i))
+			if j.maxDepth > 0 && depth >= j.maxDepth {
+				return fmt.Errorf("recursive descent exceeded the maximum depth of %d", j.maxDepth)
 			}
-		}
-		if len(results) != 0 {
-			result = append(result, value)
-			output, err := j.evalRecursive(results, node)
+			if isContainer {
+				ancestors[key] = true
+			}
+			err := j.descendEach(j.descendable(children), ancestors, depth+1, fn)
+			delete(ancestors, key)
 			if err != nil {
-				return result, err
+				return err
 			}
-			result = append(result, output...)
 		}
 	}
-	return result, nil
+	return nil
+}
+
+// descendable returns the children which recursive descent is allowed to visit
+func (j *JSONPath) descendable(children []located) []located {
+	if j.descendantKeys == nil {
+		return children
+	}
+	results := []located{}
+	for _, child := range children {
+		if key, ok := child.key.(string); ok && !j.descendantKeys[key] {
+			continue
+		}
+		results = append(results, child)
+	}
+	return results
 }
 
-// evalFilter filters array according to FilterNode
-func (j *JSONPath) evalFilter(input []reflect.Value, node *FilterNode) ([]reflect.Value, error) {
-	results := []reflect.Value{}
-	for _, value := range input {
-		value, _ = template.Indirect(value)
+// evalFilter filters array or map according to FilterNode
+func (j *JSONPath) evalFilter(input []located, node *FilterNode) ([]located, error) {
+	results := []located{}
+	for _, in := range input {
+		parent := in
+		value, _ := template.Indirect(in.value)
 
-		if value.Kind() != reflect.Array && value.Kind() != reflect.Slice {
-			return input, fmt.Errorf("%v is not array or slice and cannot be filtered", value)
+		items := []located{}
+		it, isIterator := asNodeIterator(in.value)
+		switch {
+		case isIterator:
+			items = iteratorChildren(&parent, it)
+		case value.Kind() == reflect.Array, value.Kind() == reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				items = append(items, located{value: value.Index(i), parent: &parent, key: i})
+			}
+		case value.Kind() == reflect.Map:
+			// the key of each entry is available as @~
+			for _, key := range sortedMapKeys(value) {
+				items = append(items, located{value: value.MapIndex(key), parent: &parent, key: fmt.Sprint(key.Interface())})
+			}
+		default:
+			return input, fmt.Errorf("%v is not array, slice or map and cannot be filtered", value)
 		}
-		for i := 0; i < value.Len(); i++ {
-			temp := []reflect.Value{value.Index(i)}
+		for _, item := range items {
+			temp := []located{item}
 			lefts, err := j.evalList(temp, node.Left)
 
 			//case exists
 			if node.Operator == "exists" {
-				if len(lefts) > 0 {
-					results = append(results, value.Index(i))
+				if err != nil && isFunctionCall(node.Left) {
+					return input, err
+				}
+				if len(lefts) > 0 && !isFalseFunctionResult(node.Left, values(lefts)) {
+					results = append(results, item)
 				}
 				continue
 			}
@@ -518,62 +2019,374 @@ func (j *JSONPath) evalFilter(input []reflect.Value, node *FilterNode) ([]reflec
 				return input, err
 			}
 
-			var left, right interface{}
-			switch {
-			case len(lefts) == 0:
+			if len(lefts) == 0 {
 				continue
-			case len(lefts) > 1:
+			}
+			if len(lefts) > 1 && !j.relaxedComparisons {
 				return input, fmt.Errorf("can only compare one element at a time")
 			}
-			left = lefts[0].Interface()
 
 			rights, err := j.evalList(temp, node.Right)
 			if err != nil {
 				return input, err
 			}
-			switch {
-			case len(rights) == 0:
+			if node.Operator == "in" {
+				for _, l := range lefts {
+					if containsValue(values(rights), l.value.Interface()) {
+						results = append(results, item)
+						break
+					}
+				}
+				continue
+			}
+			if len(rights) == 0 {
 				continue
-			case len(rights) > 1:
+			}
+			if len(rights) > 1 && !j.relaxedComparisons {
 				return input, fmt.Errorf("can only compare one element at a time")
 			}
-			right = rights[0].Interface()
-
-			pass := false
-			switch node.Operator {
-			case "<":
-				pass, err = template.Less(left, right)
-			case ">":
-				pass, err = template.Greater(left, right)
-			case "==":
-				pass, err = template.Equal(left, right)
-			case "!=":
-				pass, err = template.NotEqual(left, right)
-			case "<=":
-				pass, err = template.LessEqual(left, right)
-			case ">=":
-				pass, err = template.GreaterEqual(left, right)
-			default:
+
+			compare, ok := comparisons[node.Operator]
+			if !ok {
 				return results, fmt.Errorf("unrecognized filter operator %s", node.Operator)
 			}
-			if err != nil {
-				return results, err
+			if strict, ok := strictComparisons[node.Operator]; ok {
+				if j.strictComparisons {
+					compare = strict
+				}
+				if j.coerceNumbers {
+					compare = coercingNumbers(compare)
+				}
+			}
+			var pass bool
+			if len(lefts) == 1 && len(rights) == 1 {
+				pass, err = compare(numberPair(lefts[0].value.Interface(), rights[0].value.Interface()))
+				if err != nil {
+					return results, err
+				}
+			} else {
+				pass = compareAny(compare, lefts, rights)
 			}
 			if pass {
-				results = append(results, value.Index(i))
+				results = append(results, item)
 			}
 		}
 	}
 	return results, nil
 }
 
+// comparisons are the comparison operators of filters
+var comparisons = map[string]func(left, right interface{}) (bool, error){
+	"<":   template.Less,
+	">":   template.Greater,
+	"==":  func(left, right interface{}) (bool, error) { return template.Equal(left, right) },
+	"!=":  template.NotEqual,
+	"<=":  template.LessEqual,
+	">=":  template.GreaterEqual,
+	"<v":  compareVersions(func(c int) bool { return c < 0 }),
+	">v":  compareVersions(func(c int) bool { return c > 0 }),
+	"==v": compareVersions(func(c int) bool { return c == 0 }),
+	"!=v": compareVersions(func(c int) bool { return c != 0 }),
+	"<=v": compareVersions(func(c int) bool { return c <= 0 }),
+	">=v": compareVersions(func(c int) bool { return c >= 0 }),
+}
+
+// comparisonKind groups the kinds of values which compare with each other
+type comparisonKind int
+
+const (
+	otherComparison comparisonKind = iota
+	nilComparison
+	boolComparison
+	intComparison
+	floatComparison
+	stringComparison
+)
+
+// comparisonKindOf returns the kind of the value for strict comparisons, integers of all
+// sizes and signedness compare with each other
+func comparisonKindOf(v interface{}) comparisonKind {
+	value, isNil := template.Indirect(reflect.ValueOf(v))
+	if isNil {
+		return nilComparison
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		return boolComparison
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return intComparison
+	case reflect.Float32, reflect.Float64:
+		return floatComparison
+	case reflect.String:
+		return stringComparison
+	}
+	return otherComparison
+}
+
+// strictComparisons replace the comparisons of the same operator, see SetStrictComparisons
+var strictComparisons = map[string]func(left, right interface{}) (bool, error){
+	"<":  strictComparison("<"),
+	">":  strictComparison(">"),
+	"==": strictComparison("=="),
+	"!=": strictComparison("!="),
+	"<=": strictComparison("<="),
+	">=": strictComparison(">="),
+}
+
+// strictComparison returns the comparison of the operator for SetStrictComparisons. It
+// never fails, values which cannot be compared are only unequal.
+func strictComparison(operator string) func(left, right interface{}) (bool, error) {
+	compare := comparisons[operator]
+	return func(left, right interface{}) (bool, error) {
+		l, r := comparisonKindOf(left), comparisonKindOf(right)
+		if l != r && (l == intComparison || l == floatComparison) && (r == intComparison || r == floatComparison) {
+			left, right = toFloat(left), toFloat(right)
+		} else if l != r {
+			return operator == "!=", nil
+		}
+		pass, err := compare(left, right)
+		if err != nil {
+			return operator == "!=", nil
+		}
+		return pass, nil
+	}
+}
+
+// coercingNumbers returns the comparison converting both values to float64 before
+// comparing them, if one is a number and the other a number or a string holding a number,
+// see CoerceNumericStrings
+func coercingNumbers(compare func(left, right interface{}) (bool, error)) func(left, right interface{}) (bool, error) {
+	return func(left, right interface{}) (bool, error) {
+		l, lNumber, lOK := coercedNumber(left)
+		r, rNumber, rOK := coercedNumber(right)
+		if lOK && rOK && (lNumber || rNumber) {
+			return compare(l, r)
+		}
+		return compare(left, right)
+	}
+}
+
+// coercedNumber returns the value of a number or of a string holding a number as float64,
+// whether the value is a number, and whether it has a numeric value at all
+func coercedNumber(v interface{}) (float64, bool, bool) {
+	switch comparisonKindOf(v) {
+	case intComparison, floatComparison:
+		return toFloat(v), true, true
+	case stringComparison:
+		value, _ := template.Indirect(reflect.ValueOf(v))
+		f, err := strconv.ParseFloat(strings.TrimSpace(value.String()), 64)
+		return f, false, err == nil
+	}
+	return 0, false, false
+}
+
+// toFloat converts a number to float64
+func toFloat(v interface{}) float64 {
+	value, _ := template.Indirect(reflect.ValueOf(v))
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint())
+	}
+	return value.Float()
+}
+
+// compareVersions returns a comparison of dotted version strings like 1.10.0, which holds
+// if the result of comparing the versions segment by segment is accepted. Missing segments
+// count as 0, and invalid versions never compare.
+func compareVersions(accept func(c int) bool) func(left, right interface{}) (bool, error) {
+	return func(left, right interface{}) (bool, error) {
+		l, ok := parseVersion(left)
+		if !ok {
+			return false, nil
+		}
+		r, ok := parseVersion(right)
+		if !ok {
+			return false, nil
+		}
+		for i := 0; i < len(l) || i < len(r); i++ {
+			var a, b int
+			if i < len(l) {
+				a = l[i]
+			}
+			if i < len(r) {
+				b = r[i]
+			}
+			if a != b {
+				if a < b {
+					return accept(-1), nil
+				}
+				return accept(1), nil
+			}
+		}
+		return accept(0), nil
+	}
+}
+
+// parseVersion returns the numeric segments of a version string with an optional v prefix
+func parseVersion(v interface{}) ([]int, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	s = strings.TrimPrefix(s, "v")
+	segments := []int{}
+	for _, segment := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(segment)
+		if err != nil || n < 0 || strings.HasPrefix(segment, "+") {
+			return nil, false
+		}
+		segments = append(segments, n)
+	}
+	return segments, true
+}
+
+// compareAny reports whether the comparison holds for any pair of left and right values,
+// see RelaxedComparisons. Pairs of incomparable types never match.
+func compareAny(compare func(left, right interface{}) (bool, error), lefts, rights []located) bool {
+	for _, left := range lefts {
+		for _, right := range rights {
+			if pass, err := compare(numberPair(left.value.Interface(), right.value.Interface())); err == nil && pass {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsValue reports whether one of the values equals v. A single array or slice
+// value is treated as the list of its elements.
+func containsValue(values []reflect.Value, v interface{}) bool {
+	for _, value := range elements(values) {
+		// values of incomparable types are never equal
+		if equal, err := template.Equal(numberPair(v, value.Interface())); err == nil && equal {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonNumber returns the int64 or float64 value of a json.Number, as decoded by a
+// json.Decoder with UseNumber, so that it compares as a number. Other values are
+// returned unchanged.
+func jsonNumber(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return v
+}
+
+// numberPair converts a pair of values compared with each other like jsonNumber. If one is
+// an integer and the other a floating point number, e.g. 2 and 2.5, both are converted to
+// float64 so that they compare numerically.
+func numberPair(left, right interface{}) (interface{}, interface{}) {
+	left, right = jsonNumber(left), jsonNumber(right)
+	l, r := comparisonKindOf(left), comparisonKindOf(right)
+	if l != r && (l == intComparison || l == floatComparison) && (r == intComparison || r == floatComparison) {
+		return toFloat(left), toFloat(right)
+	}
+	return left, right
+}
+
+// textValue returns the text of a value implementing encoding.TextMarshaler, so that e.g. a
+// time.Time is printed as a single value. Failing that, fmt.Stringer and error are used for
+// leaf values, i.e. values which are neither containers nor structs with exported fields,
+// and for all values if preferStringer is set.
+func textValue(v reflect.Value, preferStringer bool) (string, bool, error) {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) || !v.CanInterface() {
+		return "", false, nil
+	}
+	if _, ok := v.Interface().(json.Number); ok {
+		// printed as a number rather than by its String method
+		return "", false, nil
+	}
+	candidates := []reflect.Value{v}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		// methods with pointer receivers
+		candidates = append(candidates, v.Addr())
+	}
+	for _, c := range candidates {
+		if m, ok := c.Interface().(encoding.TextMarshaler); ok {
+			text, err := m.MarshalText()
+			return string(text), err == nil, err
+		}
+	}
+	if !preferStringer && !isLeaf(v) {
+		return "", false, nil
+	}
+	for _, c := range candidates {
+		if s, ok := stringMethod(c.Interface()); ok {
+			return s, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// stringMethod returns the result of the Error or String method of the value. A panicking
+// method, e.g. one printing its receiver and thereby calling itself, counts as missing.
+func stringMethod(v interface{}) (s string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			s, ok = "", false
+		}
+	}()
+	switch v := v.(type) {
+	case error:
+		return v.Error(), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// isLeaf reports whether the value is printed as a whole rather than by its contents
+func isLeaf(v reflect.Value) bool {
+	v, _ = template.Indirect(v)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return false
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // evalToText translates reflect value to corresponding text
 func (j *JSONPath) evalToText(v reflect.Value) ([]byte, error) {
 	iface, ok := template.PrintableValue(v)
 	if !ok {
 		return nil, fmt.Errorf("can't print type %s", v.Type())
 	}
+	iface = jsonNumber(iface)
 	var buffer bytes.Buffer
+	switch iface.(type) {
+	case float32, float64:
+		if j.floatFormat != "" {
+			fmt.Fprintf(&buffer, j.floatFormat, iface)
+			return buffer.Bytes(), nil
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		if j.intFormat != "" {
+			fmt.Fprintf(&buffer, j.intFormat, iface)
+			return buffer.Bytes(), nil
+		}
+	}
 	fmt.Fprint(&buffer, iface)
 	return buffer.Bytes(), nil
 }
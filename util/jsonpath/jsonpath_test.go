@@ -19,11 +19,17 @@ package jsonpath
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type jsonpathTest struct {
@@ -62,6 +68,37 @@ func testJSONPath(tests []jsonpathTest, allowMissingKeys bool, t *testing.T) {
 	}
 }
 
+// testJSONPathWithSetup runs the tests like testJSONPath, calling setup on every JSONPath before parsing
+func testJSONPathWithSetup(tests []jsonpathTest, setup func(j *JSONPath), t *testing.T) {
+	for _, test := range tests {
+		j := New(test.name)
+		if setup != nil {
+			setup(j)
+		}
+		err := j.Parse(test.template)
+		if err != nil {
+			if !test.expectError {
+				t.Errorf("in %s, parse %s error %v", test.name, test.template, err)
+			}
+			continue
+		}
+		buf := new(bytes.Buffer)
+		err = j.Execute(buf, test.input)
+		if test.expectError {
+			if err == nil {
+				t.Errorf(`in %s, expected execute error, got %q`, test.name, buf)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("in %s, execute error %v", test.name, err)
+		}
+		out := buf.String()
+		if out != test.expect {
+			t.Errorf(`in %s, expect to get "%s", got "%s"`, test.name, test.expect, out)
+		}
+	}
+}
+
 // testJSONPathSortOutput test cases related to map, the results may print in random order
 func testJSONPathSortOutput(tests []jsonpathTest, t *testing.T) {
 	for _, test := range tests {
@@ -880,11 +917,11 @@ func TestStep(t *testing.T) {
 				false,
 			},
 			{
-				"test containers[0:6:0], it errors",
+				"test containers[0:6:0], it is empty",
 				`{.spec.containers[0:6:0].name}`,
 				data,
 				"",
-				true,
+				false,
 			},
 			{
 				"test containers[0:6:-1], it errors",
@@ -947,3 +984,2224 @@ func TestStep(t *testing.T) {
 		t,
 	)
 }
+
+func TestNegativeStep(t *testing.T) {
+	var input = []byte(
+		`{
+			"kind": "List",
+			"items": [
+				{
+					"metadata": {"name": "pod1"},
+					"spec": {
+						"containers": [
+							{"name": "fake0"},
+							{"name": "fake1"},
+							{"name": "fake2"},
+							{"name": "fake3"}
+						]
+					}
+				},
+				{
+					"metadata": {"name": "pod2"},
+					"spec": {
+						"containers": [
+							{"name": "fake4"},
+							{"name": "fake5"}
+						]
+					}
+				}
+			]
+		}`)
+
+	var data interface{}
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testJSONPath(
+		[]jsonpathTest{
+			{
+				"test containers[3:0:-1]",
+				`{.items[0].spec.containers[3:0:-1].name}`,
+				data,
+				"fake3 fake2 fake1",
+				false,
+			},
+			{
+				"test containers[-1:-4:-2]",
+				`{.items[0].spec.containers[-1:-4:-2].name}`,
+				data,
+				"fake3 fake1",
+				false,
+			},
+			{
+				"test containers[-1:-5:-1], includes the first element",
+				`{.items[0].spec.containers[-1:-5:-1].name}`,
+				data,
+				"fake3 fake2 fake1 fake0",
+				false,
+			},
+			{
+				"test containers[1:1:-1], it equals the empty set",
+				`{.items[0].spec.containers[1:1:-1].name}`,
+				data,
+				"",
+				false,
+			},
+			{
+				"test descendant containers[1:0:-1]",
+				`{..containers[1:0:-1].name}`,
+				data,
+				"fake1 fake5",
+				false,
+			},
+			{
+				"test descendant containers[-1:-3:-1]",
+				`{..containers[-1:-3:-1].name}`,
+				data,
+				"fake3 fake2 fake5 fake4",
+				false,
+			},
+			{
+				"test negative step inside a filter",
+				`{.items[?(@.spec.containers[-1:-2:-1].name=="fake5")].metadata.name}`,
+				data,
+				"pod2",
+				false,
+			},
+			{
+				"test range over containers[2:0:-1]",
+				`{range .items[0].spec.containers[2:0:-1]}{.name},{end}`,
+				data,
+				"fake2,fake1,",
+				false,
+			},
+			{
+				"test containers[0:3:-1], expect error cause start index is less than end index",
+				`{.items[0].spec.containers[0:3:-1].name}`,
+				data,
+				"",
+				true,
+			},
+			{
+				"test containers[5:0:-1], expect error cause it out of bounds",
+				`{.items[0].spec.containers[5:0:-1].name}`,
+				data,
+				"",
+				true,
+			},
+			{
+				"test containers[2::-1], end index defaults to before the first element",
+				`{.items[0].spec.containers[2::-1].name}`,
+				data,
+				"fake2 fake1 fake0",
+				false,
+			},
+			{
+				"test containers[:1:-1], start index defaults to the last element",
+				`{.items[0].spec.containers[:1:-1].name}`,
+				data,
+				"fake3 fake2",
+				false,
+			},
+			{
+				"test containers[::-1], reverses all elements",
+				`{.items[*].spec.containers[::-1].name}`,
+				data,
+				"fake3 fake2 fake1 fake0 fake5 fake4",
+				false,
+			},
+		},
+		false,
+		t,
+	)
+
+	letters := []string{"a", "b", "c", "d", "e", "f", "g"}
+	testJSONPath(
+		[]jsonpathTest{
+			{"[::-1]", `{[::-1]}`, letters, "g f e d c b a", false},
+			{"[5:1:-2]", `{[5:1:-2]}`, letters, "f d", false},
+			{"[-1:-5:-2]", `{[-1:-5:-2]}`, letters, "g e", false},
+			{"[::-3]", `{[::-3]}`, letters, "g d a", false},
+			{"[::-1] of empty", `{[::-1]}`, []string{}, "", false},
+		},
+		false,
+		t,
+	)
+}
+
+func TestFlattenToScalars(t *testing.T) {
+	var input = []byte(`{
+		"metadata": {"name": "node1", "labels": {"zone": "b", "arch": "amd64"}},
+		"status": {
+			"capacity": {"cpu": "4", "pods": 110},
+			"addresses": [
+				{"type": "InternalIP", "address": "10.0.0.1"},
+				{"type": "Hostname", "address": "node1"}
+			]
+		}
+	}`)
+	var data interface{}
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		input    interface{}
+		delim    string
+		expect   string
+	}{
+		{"scalar", `{.metadata.name}`, data, ",", "node1"},
+		{"map", `{.status.capacity}`, data, ",", "4,110"},
+		{"nested", `{.status}`, data, " ", "10.0.0.1 InternalIP node1 Hostname 4 110"},
+		{"multiple results", `{.status.addresses[*].type}`, data, "|", "InternalIP|Hostname"},
+		{"text and results", `{.metadata.name}: {.metadata.labels}`, data, ";", "node1: amd64;b"},
+		{"struct", `{.Book[0]}`, store{Book: []book{{"reference", "Nigel Rees", "Sayings of the Centurey", 8.95}}},
+			"/", "reference/Nigel Rees/Sayings of the Centurey/8.95"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		j.FlattenToScalars(test.delim)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, test.input); err != nil {
+			t.Fatalf("in %s, execute error %v", test.name, err)
+		}
+		if out := buf.String(); out != test.expect {
+			t.Errorf(`in %s, expect to get "%s", got "%s"`, test.name, test.expect, out)
+		}
+	}
+}
+
+func TestExecuteOrNoResults(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "phase": "Running"},
+			map[string]interface{}{"name": "pod2", "phase": "Pending"},
+		},
+		"empty": []interface{}{},
+	}
+
+	tests := []struct {
+		name      string
+		template  string
+		expect    string
+		noResults bool
+	}{
+		{"match", `{.items[?(@.phase=="Running")].name}`, "pod1", false},
+		{"no match", `{.items[?(@.phase=="Failed")].name}`, "", true},
+		{"no match with text", `pods: {.items[?(@.phase=="Failed")].name}{"\n"}`, "pods: \n", true},
+		{"empty range", `{range .empty[*]}{.name}{end}`, "", true},
+		{"range", `{range .items[*]}{.name},{end}`, "pod1,pod2,", false},
+		{"missing key", `{.missing}`, "", true},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		j.AllowMissingKeys(true)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		buf := new(bytes.Buffer)
+		err := j.ExecuteOrNoResults(buf, data)
+		if test.noResults {
+			if !errors.Is(err, ErrNoResults) {
+				t.Errorf("in %s, expect ErrNoResults, got %v", test.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("in %s, execute error %v", test.name, err)
+		}
+		if out := buf.String(); out != test.expect {
+			t.Errorf(`in %s, expect to get "%s", got "%s"`, test.name, test.expect, out)
+		}
+	}
+
+	j := New("error")
+	if err := j.Parse(`{.missing}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.ExecuteOrNoResults(new(bytes.Buffer), data); err == nil || errors.Is(err, ErrNoResults) {
+		t.Errorf("expect a missing key error, got %v", err)
+	}
+}
+
+func TestBindVariable(t *testing.T) {
+	data := map[string]interface{}{
+		"region":   "eu",
+		"replicas": 3,
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "region": "us", "replicas": 1},
+			map[string]interface{}{"name": "pod2", "region": "eu", "replicas": 3},
+			map[string]interface{}{"name": "pod3", "region": "eu", "replicas": 5},
+		},
+	}
+
+	tests := []jsonpathTest{
+		{"variable", `{$region}`, data, "eu-west", false},
+		{"variable and root", `{$.region}/{$region}`, data, "eu/eu-west", false},
+		{"filter by string variable", `{.items[?(@.region==$short)].name}`, data, "pod2 pod3", false},
+		{"filter by int variable", `{.items[?(@.replicas>=$min)].name}`, data, "pod2 pod3", false},
+		{"variable on the left", `{.items[?($short==@.region)].name}`, data, "pod2 pod3", false},
+		{"variable in range", `{range .items[?(@.region!=$short)]}{.name} is not in {$short}{end}`, data, "pod1 is not in eu", false},
+		{"nil variable", `{$none}`, data, "", false},
+		{"unbound variable", `{$unknown}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.BindVariable("region", "eu-west").
+			BindVariable("short", "eu").
+			BindVariable("min", 3).
+			BindVariable("none", nil)
+	}, t)
+}
+
+func TestExecuteWith(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "region": "us"},
+			map[string]interface{}{"name": "pod2", "region": "eu"},
+			map[string]interface{}{"name": "pod3", "region": "eu"},
+		},
+	}
+	j := New("execute with")
+	j.AllowMissingKeys(true).BindVariable("prefix", "-")
+	if err := j.Parse(`{range .items[?(@.region==$region)]}{$prefix}{.name}{end}`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vars   map[string]interface{}
+		expect string
+	}{
+		{map[string]interface{}{"region": "eu"}, "-pod2-pod3"},
+		{map[string]interface{}{"region": "us"}, "-pod1"},
+		{map[string]interface{}{"region": "us", "prefix": "+"}, "+pod1"},
+		{map[string]interface{}{"region": "ap"}, ""},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := j.ExecuteWith(buf, data, test.vars); err != nil {
+			t.Fatalf("with %v, execute error %v", test.vars, err)
+		}
+		if out := buf.String(); out != test.expect {
+			t.Errorf(`with %v, expect to get "%s", got "%s"`, test.vars, test.expect, out)
+		}
+	}
+	if _, ok := j.variables["region"]; ok {
+		t.Errorf("expect per call variables not to be bound to the template")
+	}
+	if err := j.Execute(new(bytes.Buffer), data); err == nil {
+		t.Errorf("expect an error for the unbound variable region")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(tests))
+	for i := 0; i < 2; i++ {
+		for _, test := range tests {
+			wg.Add(1)
+			go func(vars map[string]interface{}, expect string) {
+				defer wg.Done()
+				buf := new(bytes.Buffer)
+				if err := j.ExecuteWith(buf, data, vars); err != nil {
+					errs <- err
+				} else if out := buf.String(); out != expect {
+					errs <- fmt.Errorf(`with %v, expect to get "%s", got "%s"`, vars, expect, out)
+				}
+			}(test.vars, test.expect)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestExecuteRangeTwice(t *testing.T) {
+	data := map[string]interface{}{"items": []interface{}{1, 2}}
+	j := New("range twice")
+	if err := j.Parse(`{range .items[*]}{@},{end}!`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, data); err != nil {
+			t.Fatalf("in run %d, execute error %v", i, err)
+		}
+		if out := buf.String(); out != "1,2,!" {
+			t.Errorf(`in run %d, expect to get "1,2,!", got "%s"`, i, out)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod0"},
+			map[string]interface{}{"name": "pod1"},
+			map[string]interface{}{"name": "pod2"},
+			map[string]interface{}{"name": "pod3"},
+		},
+	}
+	tests := []jsonpathTest{
+		{"index in filter", `{.items[?(@index<2)].name}`, data, "pod0 pod1", false},
+		{"index compared to field", `{.items[?(@index==3)].name}`, data, "pod3", false},
+		{"index in range", `{range .items[1:3]}{@index}={.name} {end}`, data, "1=pod1 2=pod2 ", false},
+		{"index of reversed slice", `{range .items[3:1:-1]}{@index},{end}`, data, "3,2,", false},
+		{"index of root", `{@index}`, data, "", false},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestFindResultsWithIndices(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod0", "phase": "Running"},
+			map[string]interface{}{"name": "pod1", "phase": "Pending"},
+			map[string]interface{}{"name": "pod2", "phase": "Running"},
+		},
+		"tags": []string{"a", "b", "c", "d"},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expect   []int
+	}{
+		{"filter", `{.items[?(@.phase=="Running")]}`, []int{0, 2}},
+		{"slice", `{.tags[1:4:2]}`, []int{1, 3}},
+		{"negative index", `{.tags[-1]}`, []int{3}},
+		{"wildcard", `{.tags[*]}`, []int{0, 1, 2, 3}},
+		{"union", `{.tags[3,0]}`, []int{3, 0}},
+		{"field of element", `{.items[*].name}`, []int{-1, -1, -1}},
+		{"root", `{@}`, []int{-1}},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		results, err := j.FindResultsWithIndices(data)
+		if err != nil {
+			t.Fatalf("in %s, execute error %v", test.name, err)
+		}
+		indices := []int{}
+		for _, r := range results[0] {
+			indices = append(indices, r.Index)
+		}
+		if !reflect.DeepEqual(indices, test.expect) {
+			t.Errorf("in %s, expect indices %v, got %v", test.name, test.expect, indices)
+		}
+	}
+
+	j := New("values")
+	if err := j.Parse(`{.tags[2:]}`); err != nil {
+		t.Fatal(err)
+	}
+	results, err := j.FindResultsWithIndices(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results[0]) != 2 || results[0][0].Value.Interface() != "c" || results[0][1].Value.Interface() != "d" {
+		t.Errorf("expect to get values c and d, got %v", results)
+	}
+}
+
+func TestFindResultsWithKeys(t *testing.T) {
+	var data interface{}
+	err := json.Unmarshal([]byte(`{"store": {
+		"book": [
+			{"author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+			{"author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+		],
+		"bicycle": {"color": "red", "price": 19.95}
+	}}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		template string
+		keys     []string
+		values   []interface{}
+	}{
+		{"descendant", `{$..isbn}`, []string{"isbn", "isbn"}, []interface{}{"0-553-21311-3", "0-395-19395-8"}},
+		{"books with isbn", `{$..book[?(@.isbn)].title}`, []string{"title", "title"},
+			[]interface{}{"Moby Dick", "The Lord of the Rings"}},
+		{"index of books with isbn", `{$..book[?(@.isbn)]}`, []string{"2", "3"}, nil},
+		{"wildcard", `{.store.bicycle.*}`, []string{"color", "price"}, []interface{}{"red", 19.95}},
+		{"several actions", `{.store.book[0].price} and {.store.bicycle.price}`, []string{"price", "price"},
+			[]interface{}{8.95, 19.95}},
+		{"root", `{@}`, []string{""}, nil},
+		{"function", `{sum(..price)}`, []string{""}, []interface{}{73.87}},
+	}
+	for _, test := range tests {
+		j := New(test.name).SortMapKeys(true)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		results, err := j.FindResultsWithKeys(data)
+		if err != nil {
+			t.Fatalf("in %s, execute error %v", test.name, err)
+		}
+		keys := []string{}
+		values := []interface{}{}
+		for _, r := range results {
+			keys = append(keys, r.Key)
+			values = append(values, r.Value.Interface())
+		}
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("in %s, expect keys %v, got %v", test.name, test.keys, keys)
+		}
+		if test.values != nil && !reflect.DeepEqual(values, test.values) {
+			t.Errorf("in %s, expect values %v, got %v", test.name, test.values, values)
+		}
+	}
+}
+
+func TestFilterByKey(t *testing.T) {
+	data := map[string]interface{}{
+		"replicas": map[string]int{
+			"prod":         5,
+			"prod-eu":      3,
+			"staging":      1,
+			"staging-prod": 2,
+		},
+		"items": []interface{}{"a", "b", "c"},
+	}
+	tests := []jsonpathTest{
+		{"key equals", `{.replicas[?(@~=="prod")]}`, data, "5", false},
+		{"key not equals", `{.replicas[?(@~!="prod")]}`, data, "3 1 2", false},
+		{"key matches", `{.replicas[?(match(@~, "prod.*"))]}`, data, "5 3", false},
+		{"key and value", `{.replicas[?(@>1)]}`, data, "5 3 2", false},
+		{"key in range", `{range .replicas[?(match(@~, ".*-.*"))]}{@~}={@} {end}`, data, "prod-eu=3 staging-prod=2 ", false},
+		{"key of array element", `{.items[?(@~>0)]}`, data, "b c", false},
+		{"filter scalar", `{.items[0][?(@~=="a")]}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestCompileAll(t *testing.T) {
+	templates := map[string]string{
+		"name":         `{.metadata.name}`,
+		"range":        `{range .items[*]}{.name}{end}`,
+		"unclosed":     `{.metadata.name`,
+		"bad number":   `{+12.3.0}`,
+		"plain":        `hello`,
+		"bad function": `{length(.items}`,
+	}
+	compiled, errs := CompileAll(templates)
+
+	compiledNames := []string{}
+	for name, j := range compiled {
+		compiledNames = append(compiledNames, name)
+		if j.name != name {
+			t.Errorf("expect template %s to be named after its key, got %s", name, j.name)
+		}
+	}
+	sort.Strings(compiledNames)
+	if expect := []string{"name", "plain", "range"}; !reflect.DeepEqual(compiledNames, expect) {
+		t.Errorf("expect compiled templates %v, got %v", expect, compiledNames)
+	}
+
+	expectErrs := map[string]string{
+		"unclosed":     "unclosed action",
+		"bad number":   "cannot parse number +12.3.0",
+		"bad function": "unterminated function call length",
+	}
+	if len(errs) != len(expectErrs) {
+		t.Errorf("expect %d errors, got %v", len(expectErrs), errs)
+	}
+	for name, expect := range expectErrs {
+		if err := errs[name]; err == nil || err.Error() != expect {
+			t.Errorf("in %s, expect error %q, got %v", name, expect, err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := compiled["name"].Execute(buf, map[string]interface{}{"metadata": map[string]interface{}{"name": "pod1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "pod1" {
+		t.Errorf(`expect to get "pod1", got "%s"`, buf)
+	}
+}
+
+func TestRestrictDescendantKeys(t *testing.T) {
+	var input = []byte(`{
+		"kind": "List",
+		"items": [
+			{
+				"kind": "Pod",
+				"metadata": {"name": "pod1", "labels": {"name": "web"}},
+				"spec": {"containers": [{"name": "nginx"}, {"name": "sidecar"}]}
+			},
+			{
+				"kind": "Pod",
+				"metadata": {"name": "pod2"},
+				"spec": {"containers": [{"name": "redis"}]}
+			}
+		]
+	}`)
+	var data interface{}
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []jsonpathTest{
+		{"metadata only", `{.items[*]..name}`, data, "pod1 pod2", false},
+		{"items is not descended", `{..metadata.name}`, data, "", true},
+		{"filter on restricted descent", `{.items[?(@..name=="pod2")].kind}`, data, "Pod", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.RestrictDescendantKeys([]string{"metadata"})
+	}, t)
+
+	tests = []jsonpathTest{
+		{"items and metadata", `{..metadata.name}`, data, "pod1 pod2", false},
+		{"nested keys", `{.items[*]..name}`, data, "pod1 web pod2", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.RestrictDescendantKeys([]string{"items", "metadata", "labels"})
+	}, t)
+
+	tests = []jsonpathTest{
+		{"restriction removed", `{.items[0].spec..name}`, data, "nginx sidecar", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.RestrictDescendantKeys([]string{"metadata"})
+		j.RestrictDescendantKeys(nil)
+	}, t)
+}
+
+func TestEnableTypedOutput(t *testing.T) {
+	data := map[string]interface{}{
+		"interfaces": []interface{}{true, "one", 1, 1.1, nil, map[string]interface{}{"a": 1}, []int{1, 2}},
+		"struct":     book{Title: "Go"},
+	}
+	tests := []jsonpathTest{
+		{"heterogeneous", `{.interfaces[*]}`, data, `boolean:true string:one number:1 number:1.1 null:<nil> object:{"a":1} array:[1,2]`, false},
+		{"struct", `{.struct.Title}`, data, `string:Go`, false},
+		{"text", `title: {.struct.Title}{"\n"}`, data, "title: string:Go\n", false},
+		{"text between actions", `{.interfaces[2]} of {.interfaces[1]}`, data, "number:1 of string:one", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.EnableTypedOutput(true)
+	}, t)
+
+	// the labels of ExecuteLabeled are text as well
+	j := New("labeled")
+	j.EnableTypedOutput(true)
+	if err := j.Parse(`{.struct.Title}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.ExecuteLabeled(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "[$.struct.Title] string:Go"; buf.String() != expect {
+		t.Errorf("expect to get %q, got %q", expect, buf.String())
+	}
+}
+
+func TestSetMaxOutputBytes(t *testing.T) {
+	items := make([]interface{}, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		items = append(items, map[string]interface{}{"name": fmt.Sprintf("item%d", i)})
+	}
+	data := map[string]interface{}{"items": items}
+
+	tests := []struct {
+		name     string
+		template string
+		max      int
+		expect   string
+		err      error
+	}{
+		{"under limit", `{.items[0].name}`, 10, "item0", nil},
+		{"exactly at limit", `{.items[0].name}`, 5, "item0", nil},
+		{"wildcard hits limit", `{..name}`, 16, "item0 item1 item", ErrOutputTooLarge},
+		{"no limit", `{.items[0:2].name}`, 0, "item0 item1", nil},
+	}
+	for _, test := range tests {
+		j := New(test.name).SetMaxOutputBytes(test.max)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		buf := new(bytes.Buffer)
+		err := j.Execute(buf, data)
+		if err != test.err {
+			t.Errorf("in %s, expect error %v, got %v", test.name, test.err, err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+}
+
+func TestEmitNullForMissing(t *testing.T) {
+	data := map[string]interface{}{
+		"status": map[string]interface{}{
+			"podIP":      "10.0.0.1",
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready"}},
+		},
+	}
+	tests := []jsonpathTest{
+		{"present", `{.status.podIP}`, data, "10.0.0.1", false},
+		{"absent leaf", `{.status.hostIP}`, data, "null", false},
+		{"absent deep path", `{.spec.nodeName.first}`, data, "null", false},
+		{"absent index", `{.status.conditions[3].type}`, data, "null", false},
+		{"present index", `{.status.conditions[0].type}`, data, "Ready", false},
+		{"in text", `ip={.status.hostIP}`, data, "ip=null", false},
+		{"not singular", `{.status.conditions[*].reason}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.EmitNullForMissing(true)
+	}, t)
+
+	j := New("json").EmitNullForMissing(true)
+	j.EnableJSONOutput(true)
+	if err := j.Parse(`{.status.podIP}{.status.hostIP}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "[\n    \"10.0.0.1\"\n]\n[\n    null\n]\n"; buf.String() != expect {
+		t.Errorf("expect to get %q, got %q", expect, buf.String())
+	}
+
+	typed := []jsonpathTest{
+		{"typed", `{.status.hostIP}`, data, "null:null", false},
+	}
+	testJSONPathWithSetup(typed, func(j *JSONPath) {
+		j.EmitNullForMissing(true)
+		j.EnableTypedOutput(true)
+	}, t)
+
+	j = New("values").EmitNullForMissing(true)
+	if err := j.Parse(`{.status.podIP}{.status.hostIP}`); err != nil {
+		t.Fatal(err)
+	}
+	values, err := j.ExecuteToValues(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []interface{}{"10.0.0.1", nil}; !reflect.DeepEqual(values, expect) {
+		t.Errorf("expect to get %#v, got %#v", expect, values)
+	}
+	literal, err := j.ExecuteToGoLiteral(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `[]interface{}{"10.0.0.1", nil}`; literal != expect {
+		t.Errorf("expect to get %s, got %s", expect, literal)
+	}
+}
+
+func TestFilterIn(t *testing.T) {
+	var input = []byte(`{
+		"store": {
+			"featured": ["Evelyn Waugh", "Herman Melville"],
+			"book": [
+				{"author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+				{"author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+				{"author": "Herman Melville", "title": "Moby Dick", "price": 8.99},
+				{"author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "price": 22.99}
+			],
+			"prices": [8.99, 22.99]
+		}
+	}`)
+	var data interface{}
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []jsonpathTest{
+		{"in wildcard", `{.store.book[?(@.author in $.store.featured[*])].title}`, data, "Sword of Honour Moby Dick", false},
+		{"in array", `{.store.book[?(@.author in $.store.featured)].title}`, data, "Sword of Honour Moby Dick", false},
+		{"in numbers", `{.store.book[?(@.price in $.store.prices[*])].title}`, data, "Moby Dick The Lord of the Rings", false},
+		{"in literal", `{.store.book[?(@.author in "Nigel Rees")].title}`, data, "Sayings of the Century", false},
+		{"incomparable types", `{.store.book[?(@.price in $.store.featured[*])].title}`, data, "", false},
+		{"root in comparison", `{.store.book[?(@.price==$.store.prices[0])].title}`, data, "Moby Dick", false},
+		{"in over range", `{range .store.book[?(@.author in $.store.featured[*])]}{.author};{end}`, data, "Evelyn Waugh;Herman Melville;", false},
+		{"in inside quotes", `{.store.book[?(@.title == "Lost in Space")].title}`, data, "", false},
+		{"in inside function argument", `{.store.book[?(match(@.title, ".* of the .*"))].title}`, data, "Sayings of the Century The Lord of the Rings", false},
+		{"in inside quoted function argument", `{.store.book[?(match(@.title, "lost in space"))].title}`, data, "", false},
+		{"quoted in operand", `{.store.book[?("Moby Dick" in $.store.book[*].title)].author}`, data, "Nigel Rees Evelyn Waugh Herman Melville J. R. R. Tolkien", false},
+		{"in with quoted in", `{.store.book[?(@.author in "Rees in Nigel")].title}`, data, "", false},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestNumberFormats(t *testing.T) {
+	data := map[string]interface{}{
+		"price":    12.99,
+		"replicas": 3,
+		"ratio":    float32(0.5),
+	}
+
+	formatTests := []struct {
+		name   string
+		set    func(j *JSONPath) error
+		expect bool
+	}{
+		{"float fixed", func(j *JSONPath) error { return j.SetFloatFormat("%.1f") }, true},
+		{"float exponent", func(j *JSONPath) error { return j.SetFloatFormat("%e") }, true},
+		{"float width", func(j *JSONPath) error { return j.SetFloatFormat("%8.3g") }, true},
+		{"float int verb", func(j *JSONPath) error { return j.SetFloatFormat("%d") }, false},
+		{"float two verbs", func(j *JSONPath) error { return j.SetFloatFormat("%f%f") }, false},
+		{"float text", func(j *JSONPath) error { return j.SetFloatFormat("price") }, false},
+		{"int padded", func(j *JSONPath) error { return j.SetIntFormat("%05d") }, true},
+		{"int hex", func(j *JSONPath) error { return j.SetIntFormat("%x") }, true},
+		{"int float verb", func(j *JSONPath) error { return j.SetIntFormat("%f") }, false},
+		{"int empty", func(j *JSONPath) error { return j.SetIntFormat("") }, false},
+	}
+	for _, test := range formatTests {
+		err := test.set(New(test.name))
+		if test.expect && err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+		}
+		if !test.expect && err == nil {
+			t.Errorf("in %s, expected error", test.name)
+		}
+	}
+
+	tests := []jsonpathTest{
+		{"float", `{.price}`, data, "13.0", false},
+		{"float32", `{.ratio}`, data, "0.5", false},
+		{"int", `{.replicas}`, data, "003", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.MustSetFloatFormat("%.1f")
+		if err := j.SetIntFormat("%03d"); err != nil {
+			t.Fatal(err)
+		}
+	}, t)
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected MustSetFloatFormat to panic on invalid format")
+		}
+	}()
+	New("invalid").MustSetFloatFormat("%s")
+}
+
+// the upstream API, which existing callers depend on
+var (
+	_ func(string) *JSONPath                                  = New
+	_ func(*JSONPath, string) error                           = (*JSONPath).Parse
+	_ func(*JSONPath, io.Writer, interface{}) error           = (*JSONPath).Execute
+	_ func(*JSONPath, interface{}) ([][]reflect.Value, error) = (*JSONPath).FindResults
+	_ func(*JSONPath, io.Writer, []reflect.Value) error       = (*JSONPath).PrintResults
+	_ func(*JSONPath, bool) *JSONPath                         = (*JSONPath).AllowMissingKeys
+	_ func(*JSONPath, bool)                                   = (*JSONPath).EnableJSONOutput
+)
+
+func TestUpstreamCompatibility(t *testing.T) {
+	var input = []byte(`{
+		"kind": "List",
+		"items": [
+			{"metadata": {"name": "127.0.0.1"}, "status": {"capacity": {"cpu": "4"}, "ready": true}},
+			{"metadata": {"name": "127.0.0.2"}, "status": {"capacity": {"cpu": "8"}, "ready": false}}
+		]
+	}`)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	j := New("compat")
+	if err := j.Parse(`{range .items[*]}{.metadata.name}{"\t"}{end}`); err != nil {
+		t.Fatal(err)
+	}
+	results, err := j.FindResults(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, r := range results {
+		for _, v := range r {
+			names = append(names, fmt.Sprint(v.Interface()))
+		}
+	}
+	if expect := []string{"127.0.0.1", "\t", "127.0.0.2", "\t"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("expect %q, got %q", expect, names)
+	}
+
+	tests := []jsonpathTest{
+		{"item name", `{.items[*].metadata.name}`, data, "127.0.0.1 127.0.0.2", false},
+		{"filter", `{.items[?(@.status.ready==true)].metadata.name}`, data, "127.0.0.1", false},
+		{"union", `{.items[*]['metadata.name', 'status.capacity']}`, data, `127.0.0.1 127.0.0.2 {"cpu":"4"} {"cpu":"8"}`, false},
+		{"missing key", `{.items[*].spec}`, data, "", false},
+	}
+	testJSONPath(tests, true, t)
+
+	j = New("json").AllowMissingKeys(false)
+	j.EnableJSONOutput(true)
+	if err := j.Parse(`{.items[0].status.capacity}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "[\n    {\n        \"cpu\": \"4\"\n    }\n]\n"; buf.String() != expect {
+		t.Errorf("expect %q, got %q", expect, buf.String())
+	}
+}
+
+func TestRelaxedComparisons(t *testing.T) {
+	var input = []byte(`{
+		"items": [
+			{"name": "a", "primary": "web", "aliases": ["www", "web"], "ports": [80, 443]},
+			{"name": "b", "primary": "db", "aliases": ["sql", "postgres"], "ports": [5432]},
+			{"name": "c", "primary": "cache", "aliases": [], "ports": [6379, 6380]}
+		]
+	}`)
+	var data interface{}
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []jsonpathTest{
+		{"primary among aliases", `{.items[?(@.primary==@.aliases[*])].name}`, data, "a", false},
+		{"aliases on the left", `{.items[?(@.aliases[*]=="postgres")].name}`, data, "b", false},
+		{"no alias differs", `{.items[?(@.aliases[*]!=@.primary)].name}`, data, "a b", false},
+		{"any port", `{.items[?(@.ports[*]>1000.0)].name}`, data, "b c", false},
+		{"incomparable types", `{.items[?(@.ports[*]==@.aliases[*])].name}`, data, "", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.RelaxedComparisons(true)
+	}, t)
+
+	failTests := []jsonpathTest{
+		{"strict", `{.items[?(@.primary==@.aliases[*])].name}`, data, "can only compare one element at a time", false},
+	}
+	testFailJSONPath(failTests, t)
+}
+
+type objectMeta struct {
+	Name        string            `json:"name"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+type typeMeta struct {
+	Kind string `json:"kind"`
+}
+
+type ownerInfo struct {
+	Owner string `json:"owner"`
+}
+
+type taggedPod struct {
+	typeMeta `json:",inline"`
+	*ownerInfo
+	Meta       objectMeta `json:"metadata"`
+	Ignored    string     `json:"-"`
+	Generation int64
+}
+
+func TestStructJSONTags(t *testing.T) {
+	pod := taggedPod{
+		typeMeta:   typeMeta{Kind: "Pod"},
+		ownerInfo:  &ownerInfo{Owner: "rs1"},
+		Meta:       objectMeta{Name: "pod1", DisplayName: "Pod 1", Labels: map[string]string{"app": "web"}},
+		Ignored:    "ignored",
+		Generation: 2,
+	}
+	orphan := pod
+	orphan.ownerInfo = nil
+
+	tests := []jsonpathTest{
+		{"tag", `{.metadata.name}`, pod, "pod1", false},
+		{"tag with options", `{.metadata.displayName}`, pod, "Pod 1", false},
+		{"map in tagged field", `{.metadata.labels.app}`, pod, "web", false},
+		{"go name", `{.Meta.Name}`, pod, "pod1", false},
+		{"untagged field", `{.Generation}`, pod, "2", false},
+		{"inline struct", `{.kind}`, pod, "Pod", false},
+		{"embedded pointer", `{.owner}`, pod, "rs1", false},
+		{"promoted go name", `{.Owner}`, pod, "rs1", false},
+		{"nil embedded pointer", `{.owner}`, orphan, "", true},
+		{"nil embedded pointer go name", `{.Owner}`, orphan, "", true},
+		{"pointer to struct", `{.metadata.name}`, &pod, "pod1", false},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestExecuteToValues(t *testing.T) {
+	data := map[string]interface{}{
+		"kind": "List",
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "replicas": 1, "labels": map[string]interface{}{"app": "web"}},
+			map[string]interface{}{"name": "pod2", "replicas": 2},
+		},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expect   []interface{}
+	}{
+		{"single", `{.kind}`, []interface{}{"List"}},
+		{"wildcard", `{.items[*].replicas}`, []interface{}{1, 2}},
+		{"object", `{.items[0].labels}`, []interface{}{map[string]interface{}{"app": "web"}}},
+		{"text is skipped", `kind: {.kind}{"\n"}`, []interface{}{"List"}},
+		{"range", `{range .items[*]}{.name}={.replicas}{"\n"}{end}`, []interface{}{"pod1", 1, "pod2", 2}},
+		{"function", `{fold_ascii(.kind)}`, []interface{}{"list"}},
+		{"no results", `{.items[?(@.replicas>5)].name}`, []interface{}{}},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		got, err := j.ExecuteToValues(data)
+		if err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("in %s, expect %#v, got %#v", test.name, test.expect, got)
+		}
+	}
+}
+
+func TestSkipRangeErrors(t *testing.T) {
+	var input = []byte(`{
+		"items": [
+			{"name": "pod1", "status": {"podIP": "10.0.0.1", "containers": [{"name": "a", "ready": true}]}},
+			{"name": "pod2"},
+			{"name": "pod3", "status": {"podIP": "10.0.0.3", "containers": [{"name": "b"}, {"name": "c", "ready": false}]}}
+		]
+	}`)
+	var data interface{}
+	err := json.Unmarshal(input, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []jsonpathTest{
+		{"missing field", `{range .items[*]}{.name}={.status.podIP};{end}`, data, "pod1=10.0.0.1;pod3=10.0.0.3;", false},
+		{"after range", `{range .items[*]}{.status.podIP};{end}done`, data, "10.0.0.1;10.0.0.3;done", false},
+		{"nested range", `{range .items[*]}{.name}:{range .status.containers[*]}{.name}={.ready},{end};{end}`, data,
+			"pod1:a=true,;pod3:c=false,;", false},
+		{"all iterations fail", `{range .items[*]}{.spec.nodeName}{end}done`, data, "done", false},
+		{"empty range", `{range .none[*]}{.name}{end}done`, map[string]interface{}{"none": []interface{}{}}, "done", false},
+		{"error outside of range", `{.spec}{range .items[*]}{.name}{end}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.SkipRangeErrors(true)
+	}, t)
+
+	failTests := []jsonpathTest{
+		{"strict", `{range .items[*]}{.name}={.status.podIP};{end}`, data, "status is not found", false},
+	}
+	testFailJSONPath(failTests, t)
+}
+
+func TestOmitEmptyFields(t *testing.T) {
+	pod := taggedPod{
+		typeMeta: typeMeta{Kind: "Pod"},
+		Meta:     objectMeta{Name: "pod1"},
+		Ignored:  "ignored",
+	}
+	data := map[string]interface{}{
+		"pod":   pod,
+		"books": []book{{Title: "Moby Dick", Price: 8.99}, {Author: "Nigel Rees"}},
+		"empty": book{},
+	}
+
+	tests := []jsonpathTest{
+		{"zero fields", `{.pod}`, data, `{"kind":"Pod","metadata":{"name":"pod1"}}`, false},
+		{"nested in slice", `{.books}`, data, `[{"Title":"Moby Dick","Price":8.99},{"Author":"Nigel Rees"}]`, false},
+		{"all empty", `{.empty}`, data, `{}`, false},
+		{"scalar", `{.pod.kind}`, data, `Pod`, false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.OmitEmptyFields(true)
+	}, t)
+
+	tests = []jsonpathTest{
+		{"zero fields printed by default", `{.books[1]}`, data, `{"Category":"","Author":"Nigel Rees","Title":"","Price":0}`, false},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestSortMapKeys(t *testing.T) {
+	data := map[string]interface{}{
+		"labels": map[string]interface{}{"tier": "frontend", "app": "web", "env": "prod", "zone": "a", "team": "x"},
+		"ports":  []interface{}{80, 443},
+	}
+	tests := []jsonpathTest{
+		{"keys", `{.labels.~}`, data, "app env team tier zone", false},
+		{"values", `{.labels.*}`, data, "web prod x frontend a", false},
+		{"keys and values", `{.labels.~}|{.labels.*}`, data, "app env team tier zone|web prod x frontend a", false},
+		{"range over keys", `{range .labels.~}{@}:{end}`, data, "app:env:team:tier:zone:", false},
+		{"array indexes", `{.ports.~}`, data, "0 1", false},
+		{"recursive", `{..zone}`, data, "a", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.SortMapKeys(true)
+	}, t)
+
+	randomPrintOrderTests := []jsonpathTest{
+		{"keys without sorting", `{.labels.~}`, data, "app env team tier zone", false},
+	}
+	testJSONPathSortOutput(randomPrintOrderTests, t)
+}
+
+func TestSortMapKeysNumeric(t *testing.T) {
+	data := map[string]interface{}{
+		"ints":   map[int]string{10: "ten", 2: "two", -1: "minus one", 33: "thirty-three"},
+		"floats": map[float64]string{1.5: "a", 10: "b", 0.25: "c"},
+		"mixed":  map[interface{}]string{10: "ten", "b": "bee", 2: "two", "a": "ay", 2.5: "two and a half"},
+	}
+	tests := []jsonpathTest{
+		{"int keys", `{.ints.~}`, data, "-1 2 10 33", false},
+		{"int values", `{.ints.*}`, data, "minus one two ten thirty-three", false},
+		{"float keys", `{.floats.~}`, data, "0.25 1.5 10", false},
+		{"numbers before strings", `{.mixed.*}`, data, "two two and a half ten ay bee", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.SortMapKeys(true) }, t)
+}
+
+func TestSortMapKeysDeterministic(t *testing.T) {
+	labels := map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		labels[fmt.Sprintf("key%d", i)] = i
+	}
+	data := map[string]interface{}{"labels": labels}
+	j := New("deterministic").SortMapKeys(true)
+	if err := j.Parse(`{range .labels.*}{@},{end}`); err != nil {
+		t.Fatal(err)
+	}
+	var first string
+	for run := 0; run < 20; run++ {
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, data); err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			first = buf.String()
+		} else if buf.String() != first {
+			t.Fatalf("run %d printed %q, expected %q", run, buf.String(), first)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	var pointsJSON = []byte(`[
+		{"id": "i1", "x":4, "y":-5},
+		{"id": "i2", "x":-2, "y":-5, "z":1},
+		{"id": "i3", "x":  8, "y":  3 },
+		{"id": "i4", "x": -6, "y": -1 },
+		{"id": "i5", "x":  0, "y":  2, "z": 1 },
+		{"id": "i6", "x":  1, "y":  4 }
+	]`)
+	var pointsData interface{}
+	err := json.Unmarshal(pointsJSON, &pointsData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expect   bool
+		err      bool
+	}{
+		{"exists filter", `{[?(@.z)]}`, true, false},
+		{"no match", `{[?(@.x>100.0)]}`, false, false},
+		{"text only", `points`, false, false},
+		{"second query matches", `{[?(@.x>100.0)]}{[?(@.id=="i3")]}`, true, false},
+		{"first query matches before an error", `{[0].id}{[0].missing}`, true, false},
+		{"error", `{[0].missing}`, false, true},
+		{"range", `{range [?(@.z)]}{.id}{end}`, true, false},
+		{"empty range", `{range [?(@.x>100.0)]}matched{end}`, false, false},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			matches, err := j.Matches(pointsData)
+			if test.err {
+				if err == nil {
+					t.Errorf("in %s, expected error", test.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("in %s, unexpected error %v", test.name, err)
+			}
+			if matches != test.expect {
+				t.Errorf("in %s, expect %v, got %v", test.name, test.expect, matches)
+			}
+		}
+	}
+}
+
+func TestConcurrentExecute(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "containers": []interface{}{map[string]interface{}{"name": "a"}}},
+			map[string]interface{}{"name": "pod2", "containers": []interface{}{map[string]interface{}{"name": "b"}, map[string]interface{}{"name": "c"}}},
+		},
+	}
+	j := New("concurrent")
+	if err := j.Parse(`{range .items[*]}{.name}:{range .containers[*]}{.name},{end};{end}`); err != nil {
+		t.Fatal(err)
+	}
+	expect := "pod1:a,;pod2:b,c,;"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := new(bytes.Buffer)
+			var err error
+			switch i % 3 {
+			case 0:
+				err = j.Execute(buf, data)
+			case 1:
+				err = j.ExecuteOrNoResults(buf, data)
+			default:
+				var results [][]reflect.Value
+				results, err = j.FindResults(data)
+				for _, r := range results {
+					if err == nil {
+						err = j.PrintResults(buf, r)
+					}
+				}
+			}
+			if err == nil && buf.String() != expect {
+				err = fmt.Errorf("expect to get %q, got %q", expect, buf.String())
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestVersionComparisons(t *testing.T) {
+	data := map[string]interface{}{
+		"nodes": []interface{}{
+			map[string]interface{}{"name": "a", "version": "1.9.3"},
+			map[string]interface{}{"name": "b", "version": "1.10.0"},
+			map[string]interface{}{"name": "c", "version": "v1.10"},
+			map[string]interface{}{"name": "d", "version": "1.26.1"},
+			map[string]interface{}{"name": "e", "version": "1.27.0-rc.1"},
+			map[string]interface{}{"name": "f", "version": 1.5},
+		},
+		"minimum": "1.10.0",
+	}
+	tests := []jsonpathTest{
+		{">=v", `{.nodes[?(@.version >=v "1.10.0")].name}`, data, "b c d", false},
+		{">v", `{.nodes[?(@.version >v "1.10.0")].name}`, data, "d", false},
+		{"<v", `{.nodes[?(@.version <v "1.10.0")].name}`, data, "a", false},
+		{"<=v", `{.nodes[?(@.version<=v'1.10')].name}`, data, "a b c", false},
+		{"==v missing segments", `{.nodes[?(@.version ==v "1.10")].name}`, data, "b c", false},
+		{"!=v", `{.nodes[?(@.version !=v "1.10")].name}`, data, "a d", false},
+		{"root operand", `{.nodes[?(@.version >=v $.minimum)].name}`, data, "b c d", false},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestExecuteStrict(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1"},
+			map[string]interface{}{"name": "pod2"},
+		},
+	}
+	j := New("strict")
+	if err := j.Parse(`{.items[0].name}{.items[*].spec.nodeName}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(allowMissing bool) {
+			defer wg.Done()
+			buf := new(bytes.Buffer)
+			err := j.ExecuteStrict(buf, data, allowMissing)
+			switch {
+			case allowMissing && err != nil:
+				errs <- fmt.Errorf("unexpected error %v", err)
+			case allowMissing && buf.String() != "pod1":
+				errs <- fmt.Errorf(`expect to get "pod1", got %q`, buf.String())
+			case !allowMissing && (err == nil || err.Error() != "spec is not found"):
+				errs <- fmt.Errorf(`expect error "spec is not found", got %v`, err)
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// the instance is not changed
+	if err := j.Execute(new(bytes.Buffer), data); err == nil {
+		t.Errorf("expect missing keys to fail the execution of the instance")
+	}
+}
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Parent   *treeNode   `json:"parent,omitempty"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+func TestRecursiveCycles(t *testing.T) {
+	root := &treeNode{Name: "root"}
+	child := &treeNode{Name: "child", Parent: root}
+	root.Children = []*treeNode{child}
+	self := &treeNode{Name: "self"}
+	self.Parent = self
+	shared := &treeNode{Name: "shared"}
+	dag := &treeNode{Name: "dag", Children: []*treeNode{shared, shared}}
+	cyclicMap := map[string]interface{}{"name": "map"}
+	cyclicMap["self"] = cyclicMap
+
+	tests := []jsonpathTest{
+		{"parent pointers", `{..name}`, root, "root child", false},
+		{"self reference", `{..name}`, self, "self", false},
+		{"shared values are not cycles", `{..name}`, dag, "dag shared shared", false},
+		{"cyclic map", `{..name}`, cyclicMap, "map", false},
+	}
+	testJSONPath(tests, false, t)
+
+	failTests := []jsonpathTest{
+		{"parent pointers", `{..name}`, root, "recursive descent found a cycle at *jsonpath.treeNode", false},
+	}
+	for _, test := range failTests {
+		j := New(test.name).ErrorOnCycles(true)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		err := j.Execute(new(bytes.Buffer), test.input)
+		if err == nil || err.Error() != test.expect {
+			t.Errorf("in %s, expect error %q, got %v", test.name, test.expect, err)
+		}
+	}
+	tests = []jsonpathTest{
+		{"shared values are not cycles", `{..name}`, dag, "dag shared shared", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.ErrorOnCycles(true)
+	}, t)
+}
+
+func TestMaxDepth(t *testing.T) {
+	// the leaf is five levels below the root
+	var data interface{} = map[string]interface{}{"leaf": 1.0}
+	for i := 0; i < 4; i++ {
+		data = map[string]interface{}{"next": data}
+	}
+	tests := []struct {
+		name     string
+		maxDepth int
+		expect   string
+		err      string
+	}{
+		{"unlimited", 0, "1", ""},
+		{"deep enough", 10, "1", ""},
+		{"exact depth", 5, "1", ""},
+		{"too deep", 3, "", "recursive descent exceeded the maximum depth of 3"},
+	}
+	for _, test := range tests {
+		j := New(test.name).SetMaxDepth(test.maxDepth)
+		if err := j.Parse(`{..leaf}`); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		err := j.Execute(buf, data)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("in %s, expect error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+		} else if buf.String() != test.expect {
+			t.Errorf("in %s, expect %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+}
+
+type version struct {
+	major, minor int
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("v%d.%d", v.major, v.minor)
+}
+
+type release struct {
+	Version   version    `json:"version"`
+	Previous  *version   `json:"previous"`
+	Published time.Time  `json:"published"`
+	Mirrors   []net.IP   `json:"mirrors"`
+	Tags      []string   `json:"tags"`
+	Stable    *time.Time `json:"stable"`
+}
+
+func TestTextMarshalerAndStringer(t *testing.T) {
+	published := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	data := release{
+		Version:   version{major: 1, minor: 2},
+		Previous:  &version{major: 1, minor: 1},
+		Published: published,
+		Mirrors:   []net.IP{net.IPv4(10, 0, 0, 1)},
+		Tags:      []string{"a"},
+	}
+	tests := []jsonpathTest{
+		{"stringer", `{.version}`, data, "v1.2", false},
+		{"stringer through pointer", `{.previous}`, data, "v1.1", false},
+		{"text marshaler", `{.published}`, data, "2023-04-05T06:07:08Z", false},
+		{"text marshaler in slice", `{.mirrors[0]}`, data, "10.0.0.1", false},
+		{"nil pointer", `{.stable}`, data, "<nil>", false},
+		{"other values", `{.tags}`, data, `["a"]`, false},
+		{"structs with exported fields", `{.Book[0]}`, store{Book: []book{{"reference", "Nigel Rees", "Sayings of the Centurey", 8.95}}}, `{"Category":"reference","Author":"Nigel Rees","Title":"Sayings of the Centurey","Price":8.95}`, false},
+	}
+	testJSONPath(tests, false, t)
+
+	jsonTests := []jsonpathTest{
+		{"stringer", `{.version}`, data, "[\n    \"v1.2\"\n]\n", false},
+		{"text marshaler", `{.published}`, data, "[\n    \"2023-04-05T06:07:08Z\"\n]\n", false},
+	}
+	testJSONPathWithSetup(jsonTests, func(j *JSONPath) { j.EnableJSONOutput(true) }, t)
+}
+
+func TestOutputFormat(t *testing.T) {
+	data := map[string]interface{}{
+		"spec": map[string]interface{}{"ports": []interface{}{80.0}},
+		"name": "web",
+	}
+	tests := []struct {
+		name   string
+		setup  func(j *JSONPath)
+		expect string
+	}{
+		{"legacy", func(j *JSONPath) { j.SetOutputFormat(LegacyOutput) }, `{"ports":[80]}web`},
+		{"json", func(j *JSONPath) { j.SetOutputFormat(JSONOutput) },
+			"[\n    {\n        \"ports\": [\n            80\n        ]\n    }\n]\n[\n    \"web\"\n]\n"},
+		{"condensed", func(j *JSONPath) { j.SetOutputFormat(CondensedJSONOutput) }, "[{\"ports\":[80]}]\n[\"web\"]\n"},
+		{"back to legacy", func(j *JSONPath) {
+			j.EnableJSONOutput(true)
+			j.SetOutputFormat(LegacyOutput)
+		}, `{"ports":[80]}web`},
+		{"four spaces", func(j *JSONPath) {
+			j.SetOutputFormat(JSONOutput)
+			j.SetIndent("    ")
+		}, "[\n    {\n        \"ports\": [\n            80\n        ]\n    }\n]\n[\n    \"web\"\n]\n"},
+		{"tab", func(j *JSONPath) {
+			j.EnableJSONOutput(true)
+			j.SetIndent("\t")
+		}, "[\n\t{\n\t\t\"ports\": [\n\t\t\t80\n\t\t]\n\t}\n]\n[\n\t\"web\"\n]\n"},
+		{"indent ignored when condensed", func(j *JSONPath) {
+			j.SetOutputFormat(CondensedJSONOutput)
+			j.SetIndent("\t")
+		}, "[{\"ports\":[80]}]\n[\"web\"]\n"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		test.setup(j)
+		if err := j.Parse(`{.spec}{.name}`); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, data); err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+}
+
+func TestUnwrapSingleResult(t *testing.T) {
+	data := map[string]interface{}{
+		"spec":  map[string]interface{}{"replicas": 2.0},
+		"name":  "web",
+		"ports": []interface{}{80.0, 443.0},
+		"empty": nil,
+	}
+	tests := []struct {
+		name     string
+		template string
+		unwrap   bool
+		expect   string
+	}{
+		{"object wrapped", `{.spec}`, false, "[{\"replicas\":2}]\n"},
+		{"object unwrapped", `{.spec}`, true, "{\"replicas\":2}\n"},
+		{"scalar wrapped", `{.name}`, false, "[\"web\"]\n"},
+		{"scalar unwrapped", `{.name}`, true, "\"web\"\n"},
+		{"null unwrapped", `{.empty}`, true, "null\n"},
+		{"array unwrapped", `{.ports}`, true, "[80,443]\n"},
+		{"several results stay wrapped", `{.ports[*]}`, true, "[80,443]\n"},
+		{"no results stay wrapped", `{.ports[?(@ > 1000.0)]}`, true, "[]\n"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		j.SetOutputFormat(CondensedJSONOutput)
+		j.UnwrapSingleResult(test.unwrap)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, data); err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+}
+
+type statusError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+type endpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+func (e endpoint) String() string {
+	return fmt.Sprintf("%s:%d", e.Host, e.Port)
+}
+
+// recursiveStringer has a String method which panics, like one printing its own receiver
+type recursiveStringer struct {
+	Name string `json:"name"`
+}
+
+func (r recursiveStringer) String() string {
+	panic("recursion")
+}
+
+func TestPreferStringer(t *testing.T) {
+	data := map[string]interface{}{
+		"endpoint":  endpoint{Host: "example.com", Port: 443},
+		"err":       statusError{Code: 404, Message: "not found"},
+		"plain":     errors.New("plain error"),
+		"recursive": recursiveStringer{Name: "r"},
+		"labels":    map[string]interface{}{"app": "web"},
+	}
+	tests := []jsonpathTest{
+		{"stringer printed as JSON by default", `{.endpoint}`, data, `{"host":"example.com","port":443}`, false},
+		{"error printed as JSON by default", `{.err}`, data, `{"code":404,"message":"not found"}`, false},
+		{"leaf error", `{.plain}`, data, "plain error", false},
+	}
+	testJSONPath(tests, false, t)
+
+	tests = []jsonpathTest{
+		{"stringer", `{.endpoint}`, data, "example.com:443", false},
+		{"error", `{.err}`, data, "404: not found", false},
+		{"leaf error", `{.plain}`, data, "plain error", false},
+		{"panicking method", `{.recursive}`, data, `{"name":"r"}`, false},
+		{"other values", `{.labels}`, data, `{"app":"web"}`, false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.PreferStringer(true) }, t)
+}
+
+func TestIntegerKindComparisons(t *testing.T) {
+	kinds := []interface{}{
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+	}
+	convert := func(v int, kind interface{}) interface{} {
+		return reflect.ValueOf(v).Convert(reflect.TypeOf(kind)).Interface()
+	}
+	filters := []struct {
+		template string
+		a, b     int
+		expect   string
+	}{
+		{`{[?(@.a < @.b)].name}`, 5, 7, "pair"},
+		{`{[?(@.a < @.b)].name}`, 7, 5, ""},
+		{`{[?(@.a <= @.b)].name}`, 5, 5, "pair"},
+		{`{[?(@.a == @.b)].name}`, 5, 5, "pair"},
+		{`{[?(@.a == @.b)].name}`, 5, 7, ""},
+		{`{[?(@.a != @.b)].name}`, 5, 7, "pair"},
+		{`{[?(@.a > @.b)].name}`, 7, 5, "pair"},
+		{`{[?(@.a >= @.b)].name}`, 5, 7, ""},
+	}
+	for _, left := range kinds {
+		for _, right := range kinds {
+			for _, filter := range filters {
+				data := []interface{}{map[string]interface{}{
+					"name": "pair",
+					"a":    convert(filter.a, left),
+					"b":    convert(filter.b, right),
+				}}
+				name := fmt.Sprintf("%T %s %T", left, filter.template, right)
+				testJSONPath([]jsonpathTest{{name, filter.template, data, filter.expect, false}}, false, t)
+			}
+		}
+	}
+
+	// signed and unsigned values beyond the range of the other kind
+	data := []interface{}{
+		map[string]interface{}{"name": "negative", "a": int64(-1), "b": uint64(math.MaxUint64)},
+		map[string]interface{}{"name": "max", "a": int64(math.MaxInt64), "b": uint64(math.MaxInt64) + 1},
+		map[string]interface{}{"name": "small", "a": int8(-128), "b": uint8(255)},
+		map[string]interface{}{"name": "equal", "a": int64(math.MaxInt64), "b": uint64(math.MaxInt64)},
+	}
+	tests := []jsonpathTest{
+		{"less", `{[?(@.a < @.b)].name}`, data, "negative max small", false},
+		{"greater", `{[?(@.b > @.a)].name}`, data, "negative max small", false},
+		{"equal", `{[?(@.a == @.b)].name}`, data, "equal", false},
+		{"not equal", `{[?(@.b != @.a)].name}`, data, "negative max small", false},
+	}
+	testJSONPath(tests, false, t)
+
+	// integers compare to floating point numbers by value, but not to strings
+	mixed := []interface{}{
+		map[string]interface{}{"name": "float", "a": int8(1), "b": 1.0},
+		map[string]interface{}{"name": "fraction", "a": uint32(2), "b": 2.5},
+		map[string]interface{}{"name": "string", "a": uint16(1), "b": "1"},
+	}
+	tests = []jsonpathTest{
+		{"float", `{[?(@.a == @.b)].name}`, mixed[:2], "float", false},
+		{"fraction", `{[?(@.a < @.b)].name}`, mixed[:2], "fraction", false},
+		{"float literal", `{[?(@.a < 1.5)].name}`, mixed[:2], "float", false},
+		{"integer literal", `{[?(@.b >= 2)].name}`, mixed[:2], "fraction", false},
+		{"in", `{.items[?(@.a in $.floats)].name}`, map[string]interface{}{"items": mixed[:2], "floats": []interface{}{1.0, 3.0}}, "float", false},
+		{"string", `{[?(@.a < @.b)].name}`, mixed[2:3], "", true},
+	}
+	testJSONPath(tests, false, t)
+}
+
+func TestInterfaceKeyedMaps(t *testing.T) {
+	// maps decoded from YAML by some libraries have keys of any type
+	data := map[interface{}]interface{}{
+		"o": map[interface{}]interface{}{
+			"j": "x",
+			"k": map[interface{}]interface{}{"a": 1},
+			1:   "one",
+		},
+		"items": []interface{}{
+			map[interface{}]interface{}{"name": "a", "value": 1.0},
+			map[interface{}]interface{}{"name": "b", "value": 2.0},
+		},
+	}
+	tests := []jsonpathTest{
+		{"field", `{.o.j}`, data, "x", false},
+		{"nested field", `{.o.k.a}`, data, "1", false},
+		{"dict key", `{.o['j']}`, data, "x", false},
+		{"union", `{.o['j','k']}`, data, `x {"a":1}`, false},
+		{"missing", `{.o.missing}`, data, "", true},
+		{"non string key", `{.o.1}`, data, "", true},
+		{"map", `{.o.k}`, data, `{"a":1}`, false},
+		{"map with non string keys", `{.o}`, data, `{"1":"one","j":"x","k":{"a":1}}`, false},
+		{"recursive", `{..a}`, data, "1", false},
+		{"filter", `{.items[?(@.value > 1.0)].name}`, data, "b", false},
+		{"key filter", `{.o[?(@~ == "j")]}`, data, "x", false},
+		{"range", `{range .items[*]}{.name}{end}`, data, "ab", false},
+	}
+	testJSONPath(tests, false, t)
+
+	sorted := []jsonpathTest{
+		{"wildcard", `{.o.*}`, data, `one x {"a":1}`, false},
+		{"keys", `{.o.~}`, data, "1 j k", false},
+	}
+	testJSONPathWithSetup(sorted, func(j *JSONPath) { j.SortMapKeys(true) }, t)
+}
+
+func TestStrictComparisons(t *testing.T) {
+	data := []interface{}{
+		map[string]interface{}{"name": "string", "a": "5"},
+		map[string]interface{}{"name": "float", "a": 5.0},
+		map[string]interface{}{"name": "int", "a": 5},
+		map[string]interface{}{"name": "uint", "a": uint8(20)},
+		map[string]interface{}{"name": "bool", "a": true},
+		map[string]interface{}{"name": "null", "a": nil},
+		map[string]interface{}{"name": "list", "a": []interface{}{5}},
+	}
+	lenient := []jsonpathTest{
+		{"string less than int", `{[?(@.a < 10)].name}`, data[:1], "", true},
+		{"float less than int", `{[?(@.a < 10)].name}`, data[1:2], "float", false},
+		{"string equals string", `{[?(@.a == "5")].name}`, data[:1], "string", false},
+	}
+	testJSONPath(lenient, false, t)
+
+	strict := []jsonpathTest{
+		{"less", `{[?(@.a < 10)].name}`, data, "float int", false},
+		{"string less than int", `{[?(@.a < 10)].name}`, data[:1], "", false},
+		{"greater", `{[?(@.a > 4.5)].name}`, data, "float int uint", false},
+		{"less or equal", `{[?(@.a <= 5)].name}`, data, "float int", false},
+		{"greater or equal", `{[?(@.a >= 5.0)].name}`, data, "float int uint", false},
+		{"equal", `{[?(@.a == 5)].name}`, data, "float int", false},
+		{"not equal", `{[?(@.a != 5)].name}`, data, "string uint bool null list", false},
+		{"equal string", `{[?(@.a == "5")].name}`, data, "string", false},
+		{"equal bool", `{[?(@.a == true)].name}`, data, "bool", false},
+		{"string less than string", `{[?(@.a < "6")].name}`, data, "string", false},
+		{"version comparison", `{[?(@.a >=v "5")].name}`, data[:1], "string", false},
+	}
+	testJSONPathWithSetup(strict, func(j *JSONPath) { j.SetStrictComparisons(true) }, t)
+}
+
+func TestParentSelector(t *testing.T) {
+	var storeData interface{}
+	err := json.Unmarshal([]byte(`{"store": {
+		"book": [
+			{"author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "price": 22.99},
+			{"author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99}
+		],
+		"bicycle": {"color": "red", "price": 19.95}
+	}}`), &storeData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []jsonpathTest{
+		{"parent of matched book", `{..book[?(@.price>20.0)]^[0].title}`, storeData, "Sayings of the Century", false},
+		{"parent of all matches once", `{.store.book[?(@.price<10.0)]^[*].author}`, storeData,
+			"Nigel Rees J. R. R. Tolkien Herman Melville", false},
+		{"book of isbn", `{..isbn^.title}`, storeData, "Moby Dick", false},
+		{"parent of parent", `{..isbn^^[1].title}`, storeData, "The Lord of the Rings", false},
+		{"parents of descendants", `{..color^.price}`, storeData, "19.95", false},
+		{"key of parent", `{..isbn^~}`, storeData, "2", false},
+		{"parent in filter", `{.store.book[?(@^[0].price < 10.0)].title}`, storeData,
+			"Sayings of the Century The Lord of the Rings Moby Dick", false},
+		{"root has no parent", `{@^}`, storeData, "", false},
+		{"literal has no parent", `{"a"^}`, storeData, "", false},
+		{"escaped field name", `{.a\^b}`, map[string]interface{}{"a^b": 1}, "1", false},
+	}
+	testJSONPath(tests, true, t)
+}
+
+func TestExecuteLabeled(t *testing.T) {
+	data := map[string]interface{}{
+		"kind": "List",
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "cpu": 1.0},
+			map[string]interface{}{"name": "pod2", "cpu": 2.0},
+		},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+	}{
+		{"two queries", `{.kind}{"\n"}{.items[*].name}`, "[$.kind] List\n[$.items[*].name] pod1 pod2"},
+		{"current object", `{@.kind} { $.items[0].name }`, "[$.kind] List [$.items[0].name] pod1"},
+		{"no results", `{.items[?(@.cpu > 5.0)].name}`, "[$.items[?(@.cpu > 5.0)].name] "},
+		{"function", `{sum(.items[*].cpu)}`, "[sum(.items[*].cpu)] 3"},
+		{"range", `{range .items[*]}{.name},{end}`, "[@.name] pod1,[@.name] pod2,"},
+		{"let", `{let n := .kind}{$n}`, "[$n] List"},
+		{"text only", `kind`, "kind"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		buf := new(bytes.Buffer)
+		if err := j.ExecuteLabeled(buf, data); err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+		} else if buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+
+		// the template prints without labels afterwards
+		buf.Reset()
+		if err := j.Execute(buf, data); err != nil || strings.Contains(buf.String(), "[") {
+			t.Errorf("in %s, expect output without labels, got %q, %v", test.name, buf.String(), err)
+		}
+	}
+}
+
+func TestKeySelector(t *testing.T) {
+	data := map[string]interface{}{
+		"o":     map[string]interface{}{"j": 1, "k": 2},
+		"s":     bicycle{Color: "red", Price: 19.95},
+		"ports": []interface{}{80, 443},
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "labels": map[string]interface{}{"app": "web"}},
+			map[string]interface{}{"name": "b", "labels": map[string]interface{}{"tier": "db"}},
+		},
+	}
+	tests := []jsonpathTest{
+		{"map", `{.o[~]}`, data, "j k", false},
+		{"dot", `{.o.~}`, data, "j k", false},
+		{"struct", `{.s[~]}`, data, "Color Price IsNew", false},
+		{"array indexes", `{.ports[~]}`, data, "0 1", false},
+		{"after wildcard", `{.items[*].labels[~]}`, data, "app tier", false},
+		{"range", `{range .o[~]}{@};{end}`, data, "j;k;", false},
+		{"count", `{count(.o[~])}`, data, "2", false},
+		{"scalar has no keys", `{.o.j[~]}`, data, "", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) {
+		j.SortMapKeys(true)
+		j.RegisterFunction("count", func(args ...[]reflect.Value) ([]reflect.Value, error) {
+			return []reflect.Value{reflect.ValueOf(len(args[0]))}, nil
+		})
+	}, t)
+}
+
+func TestCoerceNumericStrings(t *testing.T) {
+	var mixed interface{}
+	if err := json.Unmarshal([]byte(`["8", 4, "2", 10, " 6 ", "1e1"]`), &mixed); err != nil {
+		t.Fatal(err)
+	}
+	tests := []jsonpathTest{
+		{"greater", `{[?(@ > 5)]}`, mixed, "8 10  6  1e1", false},
+		{"number on the left", `{[?(5 < @)]}`, mixed, "8 10  6  1e1", false},
+		{"less or equal", `{[?(@ <= 4)]}`, mixed, "4 2", false},
+		{"equal", `{[?(@ == 10)]}`, mixed, "10 1e1", false},
+		{"not equal", `{[?(@ != 10.0)]}`, mixed, "8 4 2  6 ", false},
+		{"string literal", `{[?(@ > "5")]}`, mixed, "8 10", false},
+		{"go integers", `{[?(@ > 2.5)]}`, []interface{}{"3", int8(2), uint(7)}, "3 7", false},
+		{"strings compare as strings", `{[?(@ > "10")]}`, []interface{}{"8", "2"}, "8 2", false},
+		{"non numeric string", `{[?(@ > 5)]}`, []interface{}{"abc"}, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.CoerceNumericStrings(true) }, t)
+
+	// without coercion strings and numbers are incomparable
+	testJSONPath([]jsonpathTest{{"incomparable", `{[?(@ > 5)]}`, mixed, "", true}}, false, t)
+
+	// with strict comparisons values which are no numbers are skipped
+	strict := []jsonpathTest{
+		{"non numeric string", `{[?(@ > 5)]}`, []interface{}{"abc", "8", true}, "8", false},
+	}
+	testJSONPathWithSetup(strict, func(j *JSONPath) { j.CoerceNumericStrings(true).SetStrictComparisons(true) }, t)
+}
+
+func TestGlobNames(t *testing.T) {
+	data := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				"app.kubernetes.io/name":    "web",
+				"app.kubernetes.io/part-of": "shop",
+				"app":                       "legacy",
+				"tier":                      "frontend",
+				"a*b":                       "star",
+			},
+		},
+		"spec": bicycle{Color: "red", Price: 19.95},
+		"list": []interface{}{"x", "y"},
+	}
+	tests := []jsonpathTest{
+		{"prefix", `{.metadata.labels['app.*']}`, data, "web shop", false},
+		{"prefix without dot", `{.metadata.labels['app*']}`, data, "legacy web shop", false},
+		{"dotted prefix", `{.metadata.labels.app*}`, data, "legacy web shop", false},
+		{"single character", `{.metadata.labels['ti?r']}`, data, "frontend", false},
+		{"suffix", `{.metadata.labels['*/name']}`, data, "web", false},
+		{"escaped star", `{.metadata.labels['a\*b']}`, data, "star", false},
+		{"no match", `{.metadata.labels['zone*']}`, data, "", false},
+		{"keys of matches", `{.metadata.labels['app.*']~}`, data, "app.kubernetes.io/name app.kubernetes.io/part-of", false},
+		{"struct fields", `{.spec.*o*}`, data, "red", false},
+		{"array", `{.list['*']}`, data, "", false},
+		{"literal names", `{.metadata.labels['app']}`, data, "legacy", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.SortMapKeys(true).GlobNames(true) }, t)
+
+	// without GlobNames the names are literal
+	literal := []jsonpathTest{
+		{"star", `{.metadata.labels.a\*b}`, data, "star", false},
+		{"prefix", `{.metadata.labels.app*}`, data, "", true},
+	}
+	testJSONPath(literal, false, t)
+}
+
+func TestDeduplicateResults(t *testing.T) {
+	shared := map[string]interface{}{"name": "shared", "size": 1.0}
+	data := map[string]interface{}{
+		"a":     shared,
+		"b":     shared,
+		"c":     map[string]interface{}{"name": "shared", "size": 1.0},
+		"names": []interface{}{"x", "y", "x"},
+	}
+	tests := []struct {
+		name     string
+		template string
+		all      int
+		distinct int
+	}{
+		{"descendants", `{..}`, 11, 6},
+		{"descendant names", `{..name}`, 3, 1},
+		{"wildcard", `{.names[*]}`, 3, 2},
+		{"per query", `{.names[0]}{.names[2]}`, 2, 2},
+	}
+	for _, test := range tests {
+		for _, deduplicate := range []bool{false, true} {
+			j := New(test.name).SetDeduplicateResults(deduplicate)
+			if err := j.Parse(test.template); err != nil {
+				t.Fatal(err)
+			}
+			values, err := j.ExecuteToValues(data)
+			if err != nil {
+				t.Fatalf("in %s, unexpected error %v", test.name, err)
+			}
+			expect := test.all
+			if deduplicate {
+				expect = test.distinct
+			}
+			if len(values) != expect {
+				t.Errorf("in %s with deduplication %t, expect %d values, got %d: %v",
+					test.name, deduplicate, expect, len(values), values)
+			}
+		}
+	}
+
+	printed := []jsonpathTest{
+		{"printed once", `{..name}`, data, "shared", false},
+	}
+	testJSONPathWithSetup(printed, func(j *JSONPath) { j.SetDeduplicateResults(true) }, t)
+}
+
+func TestJSONNumber(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{"items": [
+		{"name": "a", "x": 10, "y": 1.5, "z": 1.5},
+		{"name": "b", "x": 9, "y": 2.25, "z": 2},
+		{"name": "c", "x": 100, "y": -0.5, "z": 9.5}
+	], "ids": [9, 10]}`))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	tests := []jsonpathTest{
+		{"integer comparison", `{.items[?(@.x > 9)].name}`, data, "a c", false},
+		{"float comparison", `{.items[?(@.y < 2.0)].name}`, data, "a c", false},
+		{"equal", `{.items[?(@.x == 100)].name}`, data, "c", false},
+		{"numbers on both sides", `{.items[?(@.x > @.y)].name}`, data, "a b c", false},
+		{"integer and fraction of a field", `{.items[?(@.z < 2.5)].name}`, data, "a b", false},
+		{"integer literal and fraction", `{.items[?(@.y > 2)].name}`, data, "b", false},
+		{"in", `{.items[?(@.x in $.ids[*])].name}`, data, "a b", false},
+		{"sum", `{sum(.ids[*])}`, data, "19", false},
+		{"sum of fractions", `{sum(.items[*].y)}`, data, "3.25", false},
+		{"abs", `{abs(.items[2].y)} {abs(.items[0].x)}`, data, "0.5 10", false},
+		{"floor", `{floor(.items[1].y)}`, data, "2", false},
+		{"ceil", `{ceil(.items[0].y)}`, data, "2", false},
+		{"round", `{round(.items[1].y)}`, data, "2", false},
+		{"avg", `{avg(.ids[*])}`, data, "9.5", false},
+		{"percent", `{percent(.items[1].x, .items[0].x)}`, data, "90", false},
+		{"printed", `{.items[*].y}`, data, "1.5 2.25 -0.5", false},
+		{"json", `{.ids}`, data, "[9,10]", false},
+		{"type", `{type(.items[0].x)}`, data, "number", false},
+	}
+	testJSONPath(tests, false, t)
+
+	formatted := []jsonpathTest{
+		{"float format", `{.items[*].y}`, data, "1.50 2.25 -0.50", false},
+		{"int format", `{.items[*].x}`, data, "010 009 100", false},
+	}
+	testJSONPathWithSetup(formatted, func(j *JSONPath) {
+		j.MustSetFloatFormat("%.2f")
+		if err := j.SetIntFormat("%03d"); err != nil {
+			t.Fatal(err)
+		}
+	}, t)
+
+	lenient := []jsonpathTest{
+		{"mixed numbers", `{.items[?(@.x > @.y)].name}`, data, "a b c", false},
+	}
+	testJSONPathWithSetup(lenient, func(j *JSONPath) { j.SetStrictComparisons(true) }, t)
+
+	j := New("json output")
+	if err := j.Parse(`{.items[0].x}`); err != nil {
+		t.Fatal(err)
+	}
+	j.EnableJSONOutput(true)
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err != nil || buf.String() != "[\n    10\n]\n" {
+		t.Errorf("expect json number, got %q, %v", buf.String(), err)
+	}
+}
+
+type credentials struct {
+	Token string
+}
+
+type account struct {
+	Name        string      `json:"name"`
+	Password    string      `json:"-"`
+	Credentials credentials `json:"-"`
+	Region      string
+	internal    int
+}
+
+func TestWildcardExportedOnly(t *testing.T) {
+	data := map[string]interface{}{"account": account{Name: "admin", Password: "secret", Credentials: credentials{"token"}, Region: "eu", internal: 7}}
+	tests := []jsonpathTest{
+		{"wildcard", `{.account.*}`, data, "admin eu", false},
+		{"keys", `{.account.~}`, data, "name Region", false},
+		{"recursive", `{..Token}`, data, "", true},
+		{"by name", `{.account.Password}`, data, "secret", false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.WildcardExportedOnly(true) }, t)
+
+	all := []jsonpathTest{
+		{"wildcard includes all fields", `{.account.~}`, data, "name Password Credentials Region internal", false},
+		{"recursive includes all fields", `{..Token}`, data, "token", false},
+	}
+	testJSONPath(all, false, t)
+}
+
+func TestExecuteEach(t *testing.T) {
+	var pointsJSON = []byte(`[
+		{"id": "i1", "x":4, "y":-5},
+		{"id": "i2", "x":-2, "y":-5, "z":1},
+		{"id": "i3", "x":  8, "y":  3 },
+		{"id": "i4", "x": -6, "y": -1 },
+		{"id": "i5", "x":  0, "y":  2, "z": 1 },
+		{"id": "i6", "x":  1, "y":  4 }
+	]`)
+	var pointsData interface{}
+	err := json.Unmarshal(pointsJSON, &pointsData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		calls    int
+	}{
+		{"wildcard", `{[*].id}`, 6},
+		{"exists filter", `{[?(@.z)].id}`, 2},
+		{"text is skipped", `ids: {[0].id}, {[1].id}`, 2},
+		{"range", `{range [*]}{.x}{"\n"}{end}`, 6},
+		{"no match", `{[?(@.x>100.0)]}`, 0},
+		{"streamed wildcard", `{[*]}`, 6},
+		{"streamed wildcards", `{[*].*}`, 20},
+		{"streamed recursive descent", `{[*]..}`, 12},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j := New(test.name)
+			if err := j.Parse(test.template); err != nil {
+				t.Fatalf("parse %s error %v", test.template, err)
+			}
+			calls := 0
+			err := j.ExecuteEach(pointsData, func(reflect.Value) error {
+				calls++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("execute %s error %v", test.template, err)
+			}
+			if calls != test.calls {
+				t.Errorf("expected %d callbacks, got %d", test.calls, calls)
+			}
+		})
+	}
+
+	t.Run("stops at the first error", func(t *testing.T) {
+		j := New("stop")
+		if err := j.Parse(`{range [*]}{.id}{end}`); err != nil {
+			t.Fatal(err)
+		}
+		stop := errors.New("stop")
+		calls := 0
+		err := j.ExecuteEach(pointsData, func(v reflect.Value) error {
+			calls++
+			if v.Interface() == "i3" {
+				return stop
+			}
+			return nil
+		})
+		if err != stop {
+			t.Errorf("expected error %v, got %v", stop, err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 callbacks, got %d", calls)
+		}
+	})
+
+	t.Run("streams recursive descent", func(t *testing.T) {
+		cyclic := map[string]interface{}{"name": "root"}
+		cyclic["self"] = cyclic
+		j := New("stream").ErrorOnCycles(true)
+		if err := j.Parse(`{..}`); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.ExecuteEach(cyclic, func(reflect.Value) error { return nil }); err == nil {
+			t.Fatal("expected the cycle to be found")
+		}
+		// the first value is passed on before the cycle is reached
+		stop := errors.New("stop")
+		calls := 0
+		err := j.ExecuteEach(cyclic, func(reflect.Value) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Errorf("expected error %v after 1 callback, got %v after %d", stop, err, calls)
+		}
+	})
+}
+
+func TestStrictEscapesOption(t *testing.T) {
+	data := map[string]interface{}{"a": "x", "b": "y"}
+	tests := []jsonpathTest{
+		{"quoted escape", `{.a}{"\t"}{.b}`, data, "x\ty", false},
+		{"backslash in text", `{.a}\t{.b}`, data, "", true},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.StrictEscapes(true) }, t)
+
+	// without StrictEscapes the backslash is printed literally
+	literal := []jsonpathTest{
+		{"backslash in text", `{.a}\t{.b}`, data, `x\ty`, false},
+	}
+	testJSONPath(literal, false, t)
+}
+
+type (
+	stringKey string
+	intKey    int
+	uintKey   uint8
+)
+
+func TestNamedKeyTypes(t *testing.T) {
+	data := map[string]interface{}{
+		"names": map[stringKey]string{"web": "nginx", "db": "postgres"},
+		"codes": map[intKey]string{1: "one", -2: "minus two", 10: "ten"},
+		"bytes": map[uintKey]string{255: "max"},
+		"plain": map[int]string{404: "not found"},
+	}
+	tests := []jsonpathTest{
+		{"string kind key", `{.names.web}`, data, "nginx", false},
+		{"string kind dict key", `{.names['db']}`, data, "postgres", false},
+		{"string kind union", `{.names['web','db']}`, data, "nginx postgres", false},
+		{"int kind key", `{.codes.1}`, data, "one", false},
+		{"int kind dict key", `{.codes['10']}`, data, "ten", false},
+		{"negative int kind key", `{.codes['-2']}`, data, "minus two", false},
+		{"int kind union", `{.codes['1','10']}`, data, "one ten", false},
+		{"uint kind key", `{.bytes.255}`, data, "max", false},
+		{"int key", `{.plain.404}`, data, "not found", false},
+		{"int kind filter by key", `{.codes[?(@~ == "10")]}`, data, "ten", false},
+		{"missing int kind key", `{.codes.3}`, data, "", true},
+		{"non numeric name of int kind key", `{.codes.one}`, data, "", true},
+		{"uint kind key out of range", `{.bytes.256}`, data, "", true},
+	}
+	testJSONPath(tests, false, t)
+
+	missing := []jsonpathTest{
+		{"non numeric name of int kind key", `{.codes.one}`, data, "", false},
+	}
+	testJSONPath(missing, true, t)
+}
+
+func TestContinueOnError(t *testing.T) {
+	data := map[string]interface{}{
+		"name":   "web",
+		"kind":   "Service",
+		"ports":  []interface{}{80.0, 443.0},
+		"labels": map[string]interface{}{"app": "shop"},
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "size": 1.0},
+			map[string]interface{}{"name": "b"},
+		},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+		errs     []string
+	}{
+		{"missing key", `{.name} {.missing} {.kind}`, "web <error> Service",
+			[]string{"missing is not found"}},
+		{"several failures", `{.name}|{.missing}|{.ports[5]}|{.labels.app}`, "web|<error>|<error>|shop",
+			[]string{"missing is not found", "array index out of bounds: index 5, length 2"}},
+		{"type mismatch", `{.ports[?(@ > "80")]},{.name}`, "<error>,web",
+			[]string{"incompatible types for comparison"}},
+		{"inside range", `{range .items[*]}{.name}={.size};{end}`, "a=1;b=<error>;",
+			[]string{"size is not found"}},
+		{"no errors", `{.name} {.kind}`, "web Service", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j := New(test.name).ContinueOnError("<error>")
+			if err := j.Parse(test.template); err != nil {
+				t.Fatalf("parse %s error %v", test.template, err)
+			}
+			buf := new(bytes.Buffer)
+			err := j.Execute(buf, data)
+			if out := buf.String(); out != test.expect {
+				t.Errorf("expected %q, got %q", test.expect, out)
+			}
+			if test.errs == nil {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %v", test.errs)
+			}
+			if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, test.errs) {
+				t.Errorf("expected errors %q, got %q", test.errs, got)
+			}
+		})
+	}
+
+	// errors of range actions still fail the template
+	j := New("range").ContinueOnError("<error>")
+	if err := j.Parse(`{range .missing[*]}{@}{end}{.name}`); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := j.Execute(buf, data); err == nil || buf.Len() != 0 {
+		t.Errorf("expected the range to fail the template, got %q and error %v", buf.String(), err)
+	}
+
+	// without ContinueOnError nothing is printed
+	j = New("fail")
+	if err := j.Parse(`{.name} {.missing} {.kind}`); err != nil {
+		t.Fatal(err)
+	}
+	buf = new(bytes.Buffer)
+	if err := j.Execute(buf, data); err == nil || buf.Len() != 0 {
+		t.Errorf("expected the template to fail, got %q and error %v", buf.String(), err)
+	}
+}
+
+func TestIntegerLiterals(t *testing.T) {
+	data := []map[string]int{
+		{"size": 128, "count": 999},
+		{"size": 256, "count": 1000},
+		{"size": 4096, "count": 1000000},
+	}
+	tests := []jsonpathTest{
+		{"hexadecimal", `{[?(@.size>=0x100)].size}`, data, "256 4096", false},
+		{"separated", `{[?(@.count==1_000)].size}`, data, "256", false},
+		{"large separated", `{[?(@.count>=1_000_000)].size}`, data, "4096", false},
+		{"literal", `{0xff}`, data, "255", false},
+	}
+	testJSONPath(tests, false, t)
+}
@@ -16,7 +16,10 @@ limitations under the License.
 
 package jsonpath
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+)
 
 // NodeType identifies the type of a parse tree node.
 type NodeType int
@@ -43,6 +46,15 @@ const (
 	NodeRecursive
 	NodeUnion
 	NodeBool
+	NodeFunction
+	NodeVariable
+	NodeKey
+	NodeRoot
+	NodeLet
+	NodeProject
+	NodeParent
+	NodeGlob
+	NodeInclude
 )
 
 var NodeTypeName = map[NodeType]string{
@@ -58,6 +70,15 @@ var NodeTypeName = map[NodeType]string{
 	NodeRecursive:  "NodeRecursive",
 	NodeUnion:      "NodeUnion",
 	NodeBool:       "NodeBool",
+	NodeFunction:   "NodeFunction",
+	NodeVariable:   "NodeVariable",
+	NodeKey:        "NodeKey",
+	NodeRoot:       "NodeRoot",
+	NodeLet:        "NodeLet",
+	NodeProject:    "NodeProject",
+	NodeParent:     "NodeParent",
+	NodeGlob:       "NodeGlob",
+	NodeInclude:    "NodeInclude",
 }
 
 type Node interface {
@@ -69,6 +90,8 @@ type Node interface {
 type ListNode struct {
 	NodeType
 	Nodes []Node // The element nodes in lexical order.
+	// text is the source of an action, between the delimiters
+	text string
 }
 
 func newList() *ListNode {
@@ -254,3 +277,131 @@ func newBool(value bool) *BoolNode {
 func (b *BoolNode) String() string {
 	return fmt.Sprintf("%s: %t", b.Type(), b.Value)
 }
+
+// FunctionNode holds a function call and the queries of its arguments
+type FunctionNode struct {
+	NodeType
+	Name string
+	Args []*ListNode
+}
+
+func newFunction(name string, args []*ListNode) *FunctionNode {
+	return &FunctionNode{NodeType: NodeFunction, Name: name, Args: args}
+}
+
+func (f *FunctionNode) String() string {
+	return fmt.Sprintf("%s: %s", f.Type(), f.Name)
+}
+
+// VariableNode holds a reference to a variable bound by the caller
+type VariableNode struct {
+	NodeType
+	Name string
+}
+
+func newVariable(name string) *VariableNode {
+	return &VariableNode{NodeType: NodeVariable, Name: name}
+}
+
+func (v *VariableNode) String() string {
+	return fmt.Sprintf("%s: %s", v.Type(), v.Name)
+}
+
+// KeyNode means the map key or array index of the current object
+type KeyNode struct {
+	NodeType
+}
+
+func newKey() *KeyNode {
+	return &KeyNode{NodeType: NodeKey}
+}
+
+func (k *KeyNode) String() string {
+	return k.Type().String()
+}
+
+// ParentNode means the value containing the current object, selected by ^
+type ParentNode struct {
+	NodeType
+}
+
+func newParent() *ParentNode {
+	return &ParentNode{NodeType: NodeParent}
+}
+
+func (p *ParentNode) String() string {
+	return p.Type().String()
+}
+
+// GlobNode means the children of a map or struct whose names match Pattern, see GlobNames
+type GlobNode struct {
+	NodeType
+	Pattern string
+	re      *regexp.Regexp
+}
+
+func newGlob(pattern string, re *regexp.Regexp) *GlobNode {
+	return &GlobNode{NodeType: NodeGlob, Pattern: pattern, re: re}
+}
+
+func (g *GlobNode) String() string {
+	return fmt.Sprintf("%s: %s", g.Type(), g.Pattern)
+}
+
+// RootNode means the data the template is executed on, referenced as $ inside a filter
+type RootNode struct {
+	NodeType
+}
+
+func newRoot() *RootNode {
+	return &RootNode{NodeType: NodeRoot}
+}
+
+func (r *RootNode) String() string {
+	return r.Type().String()
+}
+
+// LetNode binds the results of Value to the variable Name, e.g. {let total := sum(.items[*])}
+type LetNode struct {
+	NodeType
+	Name  string
+	Value *ListNode
+}
+
+func newLet(name string, value *ListNode) *LetNode {
+	return &LetNode{NodeType: NodeLet, Name: name, Value: value}
+}
+
+func (l *LetNode) String() string {
+	return fmt.Sprintf("%s: %s", l.Type(), l.Name)
+}
+
+// IncludeNode executes the sub-template Name on the current object, e.g. {include "summary"}
+type IncludeNode struct {
+	NodeType
+	Name string
+}
+
+func newInclude(name string) *IncludeNode {
+	return &IncludeNode{NodeType: NodeInclude, Name: name}
+}
+
+func (i *IncludeNode) String() string {
+	return fmt.Sprintf("%s: %s", i.Type(), i.Name)
+}
+
+// ProjectNode builds an object whose fields hold the results of Values,
+// e.g. {project {"name": .metadata.name}}
+type ProjectNode struct {
+	NodeType
+	Keys   []string
+	Values []*ListNode
+}
+
+func newProject(keys []string, values []*ListNode) *ProjectNode {
+	return &ProjectNode{NodeType: NodeProject, Keys: keys, Values: values}
+}
+
+func (p *ProjectNode) String() string {
+	return fmt.Sprintf("%s: %v", p.Type(), p.Keys)
+}
@@ -40,12 +40,31 @@ type Parser struct {
 	pos   int
 	start int
 	width int
+	// actionStart is the position of the action being parsed
+	actionStart int
+
+	// offset is the position of the input inside the parsed template, for parsers of
+	// operands and function arguments
+	offset int
+	// arities are checked for every function call, by function name
+	arities map[string]Arity
+	// globNames makes names containing * or ? patterns, see JSONPath.GlobNames
+	globNames bool
+	// strictEscapes rejects backslashes in text outside of actions, see JSONPath.StrictEscapes
+	strictEscapes bool
+	// functions are the names of the functions which can be called, nil if any name can be
+	functions map[string]bool
 }
 
 var (
 	ErrSyntax        = errors.New("invalid syntax")
 	dictKeyRex       = regexp.MustCompile(`^'([^']*)'$`)
 	sliceOperatorRex = regexp.MustCompile(`^(-?[\d]*)(:-?[\d]*)?(:-?[\d]*)?$`)
+	// function names may have a namespace, separated by . or :
+	functionNameRex = regexp.MustCompile(`^[\pL\d_]+([.:][\pL\d_]+)?$`)
+	namespacedRex   = regexp.MustCompile(`^\.[\pL\d_]+\(`)
+	// integer literals may separate their digits by _, e.g. 1_000
+	separatedIntRex = regexp.MustCompile(`^[+-]?\d+(_\d+)+$`)
 )
 
 // Parse parsed the given text and return a node Parser.
@@ -62,28 +81,132 @@ func Parse(name, text string) (*Parser, error) {
 
 func NewParser(name string) *Parser {
 	return &Parser{
-		Name: name,
+		Name:    name,
+		arities: builtinArities,
 	}
 }
 
-// parseAction parsed the expression inside delimiter
-func parseAction(name, text string) (*Parser, error) {
-	p, err := Parse(name, fmt.Sprintf("%s%s%s", leftDelim, text, rightDelim))
-	// when error happens, p will be nil, so we need to return here
-	if err != nil {
-		return p, err
+// parseAction parsed the expression inside delimiter, found at pos of the input
+func (p *Parser) parseAction(name, text string, pos int) (*Parser, error) {
+	nested := &Parser{
+		Name:      name,
+		offset:    p.offset + pos - len(leftDelim),
+		arities:   p.arities,
+		globNames: p.globNames,
+		functions: p.functions,
 	}
-	p.Root = p.Root.Nodes[0].(*ListNode)
-	return p, nil
+	if err := nested.Parse(fmt.Sprintf("%s%s%s", leftDelim, text, rightDelim)); err != nil {
+		return nil, err
+	}
+	nested.Root = nested.Root.Nodes[0].(*ListNode)
+	return nested, nil
 }
 
 func (p *Parser) Parse(text string) error {
+	err := p.parse(text)
+	if err == nil {
+		return nil
+	}
+	var syntaxErr SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		syntaxErr = SyntaxError{pos: p.offset + p.pos, msg: err.Error()}
+	}
+	// nested parsers report the input of the outermost one
+	syntaxErr.input = text
+	return syntaxErr
+}
+
+func (p *Parser) parse(text string) error {
+	text, err := p.blankComments(text)
+	if err != nil {
+		return err
+	}
 	p.input = text
 	p.Root = newList()
 	p.pos = 0
 	return p.parseText(p.Root)
 }
 
+// SyntaxError is returned by Parse for an invalid template.
+type SyntaxError struct {
+	pos   int
+	input string
+	msg   string
+	// positioned errors mention their position in the error message
+	positioned bool
+}
+
+func (e SyntaxError) Error() string {
+	if e.positioned {
+		return fmt.Sprintf("%s at position %d", e.msg, e.pos)
+	}
+	return e.msg
+}
+
+// Position returns the byte offset into the template at which the error was detected.
+func (e SyntaxError) Position() int {
+	return e.pos
+}
+
+// Message returns the description of the error without its position.
+func (e SyntaxError) Message() string {
+	return e.msg
+}
+
+// Input returns the template which failed to parse.
+func (e SyntaxError) Input() string {
+	return e.input
+}
+
+// errorAt returns a SyntaxError mentioning pos of the input in its message
+func (p *Parser) errorAt(pos int, format string, args ...interface{}) error {
+	return SyntaxError{pos: p.offset + pos, msg: fmt.Sprintf(format, args...), positioned: true}
+}
+
+// blankComments replaces the /* ... */ comments inside the actions of the text by spaces,
+// which keeps the positions of the rest of the text. Comments start where whitespace may
+// appear, i.e. after whitespace or one of { ( [ , ? |, and not inside quoted strings.
+func (p *Parser) blankComments(text string) (string, error) {
+	if !strings.Contains(text, "/*") {
+		return text, nil
+	}
+	blanked := []byte(text)
+	depth := 0
+	var quote byte
+	for i := 0; i < len(blanked); i++ {
+		c := blanked[i]
+		switch {
+		case depth == 0:
+			if c == '{' {
+				depth++
+			}
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '/' && i+1 < len(blanked) && blanked[i+1] == '*' && strings.IndexByte(" \t\n{([,?|", blanked[i-1]) >= 0:
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return "", p.errorAt(i, "unterminated comment")
+			}
+			end += i + 2 + len("*/")
+			for ; i < end; i++ {
+				blanked[i] = ' '
+			}
+			i--
+		}
+	}
+	return string(blanked), nil
+}
+
 // consumeText return the parsed text since last cosumeText
 func (p *Parser) consumeText() string {
 	value := p.input[p.start:p.pos]
@@ -123,9 +246,13 @@ func (p *Parser) parseText(cur *ListNode) error {
 			}
 			return p.parseLeftDelim(cur)
 		}
-		if p.next() == eof {
+		r := p.next()
+		if r == eof {
 			break
 		}
+		if r == '\\' && p.strictEscapes {
+			return p.errorAt(p.pos-1, "unexpected \\ in unquoted text")
+		}
 	}
 	// Correctly reached EOF.
 	if p.pos > p.start {
@@ -138,6 +265,7 @@ func (p *Parser) parseText(cur *ListNode) error {
 func (p *Parser) parseLeftDelim(cur *ListNode) error {
 	p.pos += len(leftDelim)
 	p.consumeText()
+	p.actionStart = p.pos
 	newNode := newList()
 	cur.append(newNode)
 	cur = newNode
@@ -161,8 +289,24 @@ func (p *Parser) parseInsideAction(cur *ListNode) error {
 		return fmt.Errorf("unclosed action")
 	case r == ' ':
 		p.consumeText()
+	case r == '$' && isAlphaNumeric(p.peek()):
+		return p.parseVariable(cur)
 	case r == '@' || r == '$': //the current object, just pass it
 		p.consumeText()
+	case r == '~': //the key of the current object
+		p.consumeText()
+		cur.append(newKey())
+	case r == '|':
+		if name, ok := p.fieldContinues(cur); ok && !p.isFunction(name) {
+			return p.errorAt(p.pos-len("|"), "field name containing | has to be quoted, e.g. ['%s|%s']", lastField(cur), name)
+		}
+		return p.parsePipe(cur)
+	case r == '^': //the parent of the current object
+		if name, ok := p.fieldContinues(cur); ok {
+			return p.errorAt(p.pos-len("^"), "field name containing ^ has to be quoted, e.g. ['%s^%s'], or escaped", lastField(cur), name)
+		}
+		p.consumeText()
+		cur.append(newParent())
 	case r == '[':
 		return p.parseArray(cur)
 	case r == '"' || r == '\'':
@@ -176,29 +320,82 @@ func (p *Parser) parseInsideAction(cur *ListNode) error {
 		p.backup()
 		return p.parseIdentifier(cur)
 	default:
-		return fmt.Errorf("unrecognized character in action: %#U", r)
+		return SyntaxError{pos: p.offset + p.pos - p.width, msg: fmt.Sprintf("unrecognized character in action: %#U", r)}
 	}
 	return p.parseInsideAction(cur)
 }
 
+// fieldContinues reports whether the operator just scanned is part of a field name, i.e. it
+// directly follows a field and is directly followed by a name, which is returned
+func (p *Parser) fieldContinues(cur *ListNode) (string, bool) {
+	if lastField(cur) == "" || p.pos < 2 || isTerminator(rune(p.input[p.pos-2])) {
+		return "", false
+	}
+	end := p.pos
+	for end < len(p.input) && isAlphaNumeric(rune(p.input[end])) {
+		end++
+	}
+	return p.input[p.pos:end], end > p.pos
+}
+
+// lastField returns the name of the field the list ends with, or "" if it ends otherwise
+func lastField(cur *ListNode) string {
+	if len(cur.Nodes) == 0 {
+		return ""
+	}
+	if field, ok := cur.Nodes[len(cur.Nodes)-1].(*FieldNode); ok {
+		return field.Value
+	}
+	return ""
+}
+
+// isFunction reports whether a function of the given name can be called
+func (p *Parser) isFunction(name string) bool {
+	return p.functions == nil || p.functions[name]
+}
+
 // parseRightDelim scans the right delimiter, which is known to be present.
 func (p *Parser) parseRightDelim(cur *ListNode) error {
+	if action, ok := p.Root.Nodes[len(p.Root.Nodes)-1].(*ListNode); ok {
+		action.text = p.input[p.actionStart:p.pos]
+	}
 	p.pos += len(rightDelim)
 	p.consumeText()
 	return p.parseText(p.Root)
 }
 
-// parseIdentifier scans build-in keywords, like "range" "end"
+// parseIdentifier scans build-in keywords, like "range" "end", and function calls
 func (p *Parser) parseIdentifier(cur *ListNode) error {
 	var r rune
 	for {
 		r = p.next()
-		if isTerminator(r) {
+		if isTerminator(r) || r == '(' {
 			p.backup()
 			break
 		}
 	}
 	value := p.consumeText()
+	// a function name like ns.name, the . of a field would end the identifier
+	if name := namespacedRex.FindString(p.input[p.pos:]); name != "" && !strings.ContainsRune(value, ':') {
+		p.pos += len(name) - len("(")
+		value += p.consumeText()
+	}
+
+	if p.peek() == '(' {
+		if !functionNameRex.MatchString(value) {
+			return fmt.Errorf("invalid function name %s", value)
+		}
+		return p.parseFunction(cur, value)
+	}
+	if value == "let" {
+		return p.parseLet(cur)
+	}
+	if value == "project" {
+		return p.parseProject(cur)
+	}
+	if value == "include" {
+		return p.parseInclude(cur)
+	}
 
 	if isBool(value) {
 		v, err := strconv.ParseBool(value)
@@ -214,6 +411,298 @@ func (p *Parser) parseIdentifier(cur *ListNode) error {
 	return p.parseInsideAction(cur)
 }
 
+// parseLet scans the binding of a variable like let name := expression, the rest of the
+// action is the expression
+func (p *Parser) parseLet(cur *ListNode) error {
+	if len(cur.Nodes) != 0 {
+		return fmt.Errorf("let must start an action")
+	}
+	p.skipSpaces()
+	for isAlphaNumeric(p.peek()) {
+		p.next()
+	}
+	name := p.consumeText()
+	if name == "" {
+		return fmt.Errorf("missing variable name after let")
+	}
+	p.skipSpaces()
+	if !strings.HasPrefix(p.input[p.pos:], ":=") {
+		return fmt.Errorf("missing := after let %s", name)
+	}
+	p.pos += len(":=")
+	p.consumeText()
+	value := newList()
+	cur.append(newLet(name, value))
+	return p.parseInsideAction(value)
+}
+
+// parseInclude scans the quoted name of the sub-template of include "name"
+func (p *Parser) parseInclude(cur *ListNode) error {
+	if len(cur.Nodes) != 0 {
+		return fmt.Errorf("include must start an action")
+	}
+	p.skipSpaces()
+	p.consumeText()
+	quote := p.next()
+	if quote != '"' && quote != '\'' {
+		return fmt.Errorf("include expects a quoted template name")
+	}
+	for {
+		r := p.next()
+		if r == eof || isEndOfLine(r) {
+			return fmt.Errorf("unterminated quoted string")
+		}
+		if r == quote && p.input[p.pos-2] != '\\' {
+			break
+		}
+	}
+	value := p.consumeText()
+	name, err := UnquoteExtend(value)
+	if err != nil {
+		return fmt.Errorf("unquote string %s error %v", value, err)
+	}
+	cur.append(newInclude(name))
+	return p.parseInsideAction(cur)
+}
+
+// parseProject scans the object literal of a projection like project {"key": expression}
+func (p *Parser) parseProject(cur *ListNode) error {
+	p.skipSpaces()
+	if p.peek() != '{' {
+		return fmt.Errorf("project expects an object")
+	}
+	depth := 0
+	var quote rune
+Loop:
+	for {
+		r := p.next()
+		switch {
+		case r == eof || isEndOfLine(r):
+			return fmt.Errorf("unterminated object in project")
+		case quote != 0:
+			if r == '\\' {
+				p.next()
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+			if depth == 0 {
+				break Loop
+			}
+		}
+	}
+	pos := p.start
+	node, err := p.parseProjection(p.consumeText(), pos)
+	if err != nil {
+		return err
+	}
+	cur.append(node)
+	return p.parseInsideAction(cur)
+}
+
+// parseProjection parses an object literal found at pos of the input, whose values are
+// expressions or object literals
+func (p *Parser) parseProjection(text string, pos int) (*ProjectNode, error) {
+	keys := []string{}
+	values := []*ListNode{}
+	if strings.TrimSpace(text[1:len(text)-1]) == "" {
+		return newProject(keys, values), nil
+	}
+	start := pos + 1
+	for _, raw := range splitTopLevel(text[1:len(text)-1], ',') {
+		entry := strings.TrimSpace(raw)
+		entryPos := start + strings.Index(raw, entry)
+		start += len(raw) + len(",")
+		parts := splitTopLevel(entry, ':')
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid entry %s in project, expect \"key\": expression", entry)
+		}
+		key, err := UnquoteExtend(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s in project, keys must be quoted", parts[0])
+		}
+		// the expression may contain colons itself, e.g. in slices
+		rest := entry[len(parts[0])+1:]
+		expr := strings.TrimSpace(rest)
+		exprPos := entryPos + len(parts[0]) + 1 + strings.Index(rest, expr)
+		var value *ListNode
+		if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+			nested, err := p.parseProjection(expr, exprPos)
+			if err != nil {
+				return nil, err
+			}
+			value = newList()
+			value.append(nested)
+		} else if expr == "" {
+			return nil, fmt.Errorf("missing expression for key %s in project", key)
+		} else if value, err = p.parseOperand("project", expr, exprPos); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return newProject(keys, values), nil
+}
+
+// splitTopLevel splits the text at every separator outside of quotes and brackets
+func splitTopLevel(text string, sep byte) []string {
+	parts := []string{}
+	var quote byte
+	depth := 0
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// skipSpaces skips spaces at the current position
+func (p *Parser) skipSpaces() {
+	for isSpace(p.peek()) {
+		p.next()
+	}
+	p.consumeText()
+}
+
+// parseVariable scans a variable reference like $name
+func (p *Parser) parseVariable(cur *ListNode) error {
+	p.consumeText()
+	for {
+		r := p.next()
+		if isTerminator(r) || r == '(' || r == ')' {
+			p.backup()
+			break
+		}
+	}
+	cur.append(newVariable(p.consumeText()))
+	return p.parseInsideAction(cur)
+}
+
+// parseFunction scans the arguments of a function call, separated by commas
+func (p *Parser) parseFunction(cur *ListNode, name string) error {
+	pos := p.pos - len(name)
+	p.next()
+	p.consumeText()
+	args := []string{}
+	starts := []int{}
+	depth := 0
+	var quote rune
+Loop:
+	for {
+		r := p.next()
+		switch {
+		case r == eof || isEndOfLine(r):
+			return fmt.Errorf("unterminated function call %s", name)
+		case quote != 0:
+			if r == '\\' {
+				p.next()
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(' || r == '[':
+			depth++
+		case (r == ')' || r == ']') && depth > 0:
+			depth--
+		case r == ')':
+			args, starts = append(args, p.input[p.start:p.pos-1]), append(starts, p.start)
+			break Loop
+		case r == ',' && depth == 0:
+			args, starts = append(args, p.input[p.start:p.pos-1]), append(starts, p.start)
+			p.consumeText()
+		}
+	}
+	p.consumeText()
+
+	if len(args) == 1 && strings.TrimSpace(args[0]) == "" {
+		args = nil
+	}
+	if err := p.checkArity(name, len(args), pos); err != nil {
+		return err
+	}
+	nodes := []*ListNode{}
+	for i, arg := range args {
+		trimmed := strings.TrimSpace(arg)
+		if trimmed == "" {
+			return fmt.Errorf("empty argument in function call %s", name)
+		}
+		node, err := p.parseOperand("arg", trimmed, starts[i]+strings.Index(arg, trimmed))
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, node)
+	}
+	cur.append(newFunction(name, nodes))
+	return p.parseInsideAction(cur)
+}
+
+// checkArity fails if the function called at pos of the input does not accept the number of
+// arguments
+func (p *Parser) checkArity(name string, args, pos int) error {
+	if arity, ok := p.arities[name]; ok && !arity.accepts(args) {
+		return p.errorAt(pos, "function %s expects %s, got %d", name, arity, args)
+	}
+	return nil
+}
+
+// parsePipe scans the name of a function the results of the action so far are passed to,
+// e.g. {.items[*].cpu | sum} is evaluated like {sum(.items[*].cpu)}
+func (p *Parser) parsePipe(cur *ListNode) error {
+	p.consumeText()
+	p.skipSpaces()
+	for isAlphaNumeric(p.peek()) {
+		p.next()
+	}
+	if r := p.peek(); (r == '.' || r == ':') && p.pos > p.start {
+		p.next()
+		if !isAlphaNumeric(p.peek()) {
+			p.backup()
+		}
+		for isAlphaNumeric(p.peek()) {
+			p.next()
+		}
+	}
+	name := p.consumeText()
+	if name == "" {
+		return fmt.Errorf("missing function name after |")
+	}
+	for _, node := range cur.Nodes {
+		if node.Type() == NodeIdentifier {
+			return fmt.Errorf("cannot pipe %s to function %s", node.(*IdentifierNode).Name, name)
+		}
+	}
+	if err := p.checkArity(name, 1, p.pos-len(name)); err != nil {
+		return err
+	}
+	stage := newList()
+	stage.Nodes = cur.Nodes
+	cur.Nodes = []Node{newFunction(name, []*ListNode{stage})}
+	return p.parseInsideAction(cur)
+}
+
 // parseRecursive scans the recursive descent operator ..
 func (p *Parser) parseRecursive(cur *ListNode) error {
 	if lastIndex := len(cur.Nodes) - 1; lastIndex >= 0 && cur.Nodes[lastIndex].Type() == NodeRecursive {
@@ -234,14 +723,35 @@ func (p *Parser) parseNumber(cur *ListNode) error {
 	if r == '+' || r == '-' {
 		p.next()
 	}
+	isDigit := func(r rune) bool { return r == '.' || unicode.IsDigit(r) }
+	hex := strings.HasPrefix(p.input[p.pos:], "0x") || strings.HasPrefix(p.input[p.pos:], "0X")
+	if hex {
+		p.pos += len("0x")
+		isDigit = isHexDigit
+	}
 	for {
 		r = p.next()
-		if r != '.' && !unicode.IsDigit(r) {
+		if r != '_' && !isDigit(r) {
 			p.backup()
 			break
 		}
 	}
 	value := p.consumeText()
+	if hex {
+		i, err := strconv.ParseInt(value, 0, strconv.IntSize)
+		if err != nil {
+			return fmt.Errorf("cannot parse number %s", value)
+		}
+		cur.append(newInt(int(i)))
+		return p.parseInsideAction(cur)
+	}
+	if strings.Contains(value, "_") {
+		// _ separates the digits of integers, e.g. 1_000
+		if !separatedIntRex.MatchString(value) {
+			return fmt.Errorf("cannot parse number %s", value)
+		}
+		value = strings.ReplaceAll(value, "_", "")
+	}
 	i, err := strconv.Atoi(value)
 	if err == nil {
 		cur.append(newInt(i))
@@ -266,18 +776,25 @@ Loop:
 			break Loop
 		}
 	}
+	start := p.start
 	text := p.consumeText()
 	text = text[1 : len(text)-1]
 	if text == "*" {
 		text = ":"
 	}
+	if text == "~" {
+		// the keys of all children, like .~
+		cur.append(newWildcard())
+		cur.append(newKey())
+		return p.parseInsideAction(cur)
+	}
 
 	//union operator
 	strs := strings.Split(text, ",")
 	if len(strs) > 1 {
 		union := []*ListNode{}
 		for _, str := range strs {
-			parser, err := parseAction("union", fmt.Sprintf("[%s]", strings.Trim(str, " ")))
+			parser, err := p.parseAction("union", fmt.Sprintf("[%s]", strings.Trim(str, " ")), start)
 			if err != nil {
 				return err
 			}
@@ -289,8 +806,15 @@ Loop:
 
 	// dict key
 	value := dictKeyRex.FindStringSubmatch(text)
+	if value != nil && p.globNames {
+		if re, ok := globRegexp(value[1]); ok {
+			cur.append(newGlob(value[1], re))
+			return p.parseInsideAction(cur)
+		}
+	}
 	if value != nil {
-		parser, err := parseAction("arraydict", fmt.Sprintf(".%s", value[1]))
+		// | would be parsed as a pipe and ^ as a parent selector
+		parser, err := p.parseAction("arraydict", fmt.Sprintf(".%s", escapeOperators(value[1])), start)
 		if err != nil {
 			return err
 		}
@@ -341,8 +865,10 @@ Loop:
 func (p *Parser) parseFilter(cur *ListNode) error {
 	p.pos += len("[?(")
 	p.consumeText()
+	start := p.start
 	begin := false
 	end := false
+	depth := 0
 	var pair rune
 
 Loop:
@@ -362,10 +888,19 @@ Loop:
 			if p.input[p.pos-2] != '\\' && r == pair {
 				end = true
 			}
+		case '(':
+			if begin == end {
+				depth++
+			}
 		case ')':
 			//in rightParser below quotes only appear zero or once
 			//and must be paired at the beginning and end
 			if begin == end {
+				//skip the parentheses of function calls inside the filter
+				if depth > 0 {
+					depth--
+					continue
+				}
 				break Loop
 			}
 		}
@@ -373,30 +908,127 @@ Loop:
 	if p.next() != ']' {
 		return fmt.Errorf("unclosed array expect ]")
 	}
-	reg := regexp.MustCompile(`^([^!<>=]+)([!<>=]+)(.+?)$`)
 	text := p.consumeText()
 	text = text[:len(text)-2]
-	value := reg.FindStringSubmatch(text)
+	value := splitComparison(text)
+	if value == nil {
+		value = splitIn(text)
+	}
 	if value == nil {
-		parser, err := parseAction("text", text)
+		root, err := p.parseOperand("text", text, start)
 		if err != nil {
 			return err
 		}
-		cur.append(newFilter(parser.Root, newList(), "exists"))
+		cur.append(newFilter(root, newList(), "exists"))
 	} else {
-		leftParser, err := parseAction("left", value[1])
+		// version comparisons, e.g. @.version >=v "1.10.0"
+		if right := strings.TrimLeft(value[3], " "); value[2] != "in" && len(right) > 1 && right[0] == 'v' &&
+			(right[1] == ' ' || right[1] == '"' || right[1] == '\'') {
+			value[2] += "v"
+			value[3] = right[1:]
+		}
+		left, err := p.parseOperand("left", value[1], start)
 		if err != nil {
 			return err
 		}
-		rightParser, err := parseAction("right", value[3])
+		right, err := p.parseOperand("right", value[3], start+len(text)-len(value[3]))
 		if err != nil {
 			return err
 		}
-		cur.append(newFilter(leftParser.Root, rightParser.Root, value[2]))
+		cur.append(newFilter(left, right, value[2]))
 	}
 	return p.parseInsideAction(cur)
 }
 
+// splitComparison splits a filter expression at its comparison operator like
+// regexp.FindStringSubmatch, ignoring operators inside quotes, function calls and brackets,
+// e.g. all(@[*], "@ > 0") has none. It returns nil if there is no operator.
+func splitComparison(text string) []string {
+	const operators = "!<>="
+	var value []string
+	scanTopLevel(text, func(i int) bool {
+		if strings.IndexByte(operators, text[i]) < 0 {
+			return false
+		}
+		end := i
+		for end < len(text) && strings.IndexByte(operators, text[end]) >= 0 {
+			end++
+		}
+		if i > 0 && end < len(text) {
+			value = []string{text, text[:i], text[i:end], text[end:]}
+		}
+		return true
+	})
+	return value
+}
+
+// splitIn splits a filter expression like @.name in $.names[*] at the in operator like
+// regexp.FindStringSubmatch, ignoring " in " inside quotes, function calls and brackets,
+// e.g. match(@, "lost in space") has none. It returns nil if there is no in operator.
+func splitIn(text string) []string {
+	var value []string
+	scanTopLevel(text, func(i int) bool {
+		if i == 0 || !isSpace(rune(text[i])) {
+			return false
+		}
+		right := strings.TrimLeft(text[i:], " \t")
+		if !strings.HasPrefix(right, "in") || len(right) < 3 || !isSpace(rune(right[2])) {
+			return false
+		}
+		right = strings.TrimLeft(right[2:], " \t")
+		if right == "" || strings.TrimSpace(text[:i]) == "" {
+			return false
+		}
+		value = []string{text, text[:i], "in", right}
+		return true
+	})
+	return value
+}
+
+// scanTopLevel calls visit with the index of every byte of text which is outside of quotes,
+// function calls and brackets, until visit returns true
+func scanTopLevel(text string, visit func(i int) bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth == 0:
+			if visit(i) {
+				return
+			}
+		}
+	}
+}
+
+// parseOperand parses an operand of a filter or an argument of a function, found at pos of
+// the input. An operand starting with $ is evaluated against the root of the data instead of
+// the current object.
+func (p *Parser) parseOperand(name, text string, pos int) (*ListNode, error) {
+	trimmed := strings.TrimSpace(text)
+	fromRoot := strings.HasPrefix(trimmed, "$") && (len(trimmed) == 1 || !isAlphaNumeric(rune(trimmed[1])))
+	parser, err := p.parseAction(name, text, pos)
+	if err != nil {
+		return nil, err
+	}
+	if fromRoot {
+		parser.Root.Nodes = append([]Node{newRoot()}, parser.Root.Nodes...)
+	}
+	return parser.Root, nil
+}
+
 // parseQuote unquotes string inside double or single quote
 func (p *Parser) parseQuote(cur *ListNode, end rune) error {
 Loop:
@@ -428,12 +1060,63 @@ func (p *Parser) parseField(cur *ListNode) error {
 	value := p.consumeText()
 	if value == "*" {
 		cur.append(newWildcard())
+	} else if value == "~" {
+		// the keys of all children
+		cur.append(newWildcard())
+		cur.append(newKey())
+	} else if re, ok := globRegexp(value); ok && p.globNames {
+		cur.append(newGlob(value, re))
 	} else {
 		cur.append(newField(strings.Replace(value, "\\", "", -1)))
 	}
 	return p.parseInsideAction(cur)
 }
 
+// escapeOperators escapes the | and ^ of a quoted key which are not escaped yet, so that the
+// key is parsed as a field name
+func escapeOperators(key string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range key {
+		if !escaped && (r == '|' || r == '^') {
+			b.WriteByte('\\')
+		}
+		escaped = !escaped && r == '\\'
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// globRegexp returns the regular expression matching the names matched by a pattern, in
+// which * matches any sequence of characters, ? matches a single character and \ escapes
+// the following character. It returns false if the pattern has no unescaped * or ?.
+func globRegexp(pattern string) (*regexp.Regexp, bool) {
+	var expr strings.Builder
+	glob := false
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			expr.WriteString(".*")
+			glob = true
+		case r == '?':
+			expr.WriteString(".")
+			glob = true
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if !glob {
+		return nil, false
+	}
+	return regexp.MustCompile("^(?s:" + expr.String() + ")$"), true
+}
+
 // advance scans until next non-escaped terminator
 func (p *Parser) advance() bool {
 	r := p.next()
@@ -452,7 +1135,7 @@ func isTerminator(r rune) bool {
 		return true
 	}
 	switch r {
-	case eof, '.', ',', '[', ']', '$', '@', '{', '}':
+	case eof, '.', ',', '[', ']', '$', '@', '{', '}', '|', '^':
 		return true
 	}
 	return false
@@ -473,6 +1156,11 @@ func isAlphaNumeric(r rune) bool {
 	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
+// isHexDigit reports whether r is a hexadecimal digit.
+func isHexDigit(r rune) bool {
+	return ('0' <= r && r <= '9') || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
+}
+
 // isBool reports whether s is a boolean value.
 func isBool(s string) bool {
 	return s == "true" || s == "false"
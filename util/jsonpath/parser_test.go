@@ -17,6 +17,8 @@ limitations under the License.
 package jsonpath
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -83,6 +85,68 @@ var parserTests = []parserTest{
 		newArray([3]ParamsEntry{{-1, true, false}, {0, true, true}, {0, false, false}})}, false},
 	{"negative index slice, equals a[1] to a[len-1]", `{[1:-1]}`, []Node{newList(),
 		newArray([3]ParamsEntry{{1, true, false}, {-1, true, false}, {0, false, false}})}, false},
+	{"function", `{concat(.book[0], "a,b", 3)}`, []Node{newList(), newFunction("concat", []*ListNode{}),
+		newList(), newField("book"), newArray([3]ParamsEntry{{0, true, false}, {1, true, true}, {0, false, false}}),
+		newList(), newText("a,b"),
+		newList(), newInt(3),
+	}, false},
+	{"function without arguments", `{now()}`, []Node{newList(), newFunction("now", []*ListNode{})}, false},
+	{"nested function", `{upper(concat(@, ")"))}`, []Node{newList(), newFunction("upper", []*ListNode{}),
+		newList(), newFunction("concat", []*ListNode{}), newList(), newList(), newText(")"),
+	}, false},
+	{"variable", `{$region}`, []Node{newList(), newVariable("region")}, false},
+	{"variable in filter", `{.items[?(@.region == $region)].name}`,
+		[]Node{newList(), newField("items"), newFilter(newList(), newList(), "=="),
+			newList(), newField("region"), newList(), newVariable("region"), newField("name")}, false},
+	{"variable as function argument", `{match(.name, $pattern)}`, []Node{newList(), newFunction("match", []*ListNode{}),
+		newList(), newField("name"), newList(), newVariable("pattern")}, false},
+	{"key in filter", `{.labels[?(@~ == "app")]}`,
+		[]Node{newList(), newField("labels"), newFilter(newList(), newList(), "=="),
+			newList(), newKey(), newList(), newText("app")}, false},
+	{"root", `{$.items}`, []Node{newList(), newField("items")}, false},
+	{"version comparison", `{.items[?(@.version >=v "1.10.0")]}`,
+		[]Node{newList(), newField("items"), newFilter(newList(), newList(), ">=v"),
+			newList(), newField("version"), newList(), newText("1.10.0")}, false},
+	{"version comparison with single quotes", `{[?(@.v==v'2')]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "==v"),
+			newList(), newField("v"), newList(), newText("2")}, false},
+	{"keys", `{.labels.~}`, []Node{newList(), newField("labels"), newWildcard(), newKey()}, false},
+	{"bracketed keys", `{.labels[~]}`, []Node{newList(), newField("labels"), newWildcard(), newKey()}, false},
+	{"in with root in filter", `{.books[?(@.author in $.featured[*])]}`,
+		[]Node{newList(), newField("books"), newFilter(newList(), newList(), "in"),
+			newList(), newField("author"), newList(), newRoot(), newField("featured"), newArray([3]ParamsEntry{{0, false, false}, {0, false, false}, {0, false, false}})}, false},
+	{"function in filter", `{[?(lower(@.name)=="foo")]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "=="),
+			newList(), newFunction("lower", []*ListNode{}), newList(), newField("name"), newList(), newText("foo")}, false},
+	{"pipe", `{.items | sum | type}`, []Node{newList(), newFunction("type", []*ListNode{}),
+		newList(), newFunction("sum", []*ListNode{}), newList(), newField("items")}, false},
+	{"operator inside quotes", `{[?(all(@[*], "@ > 0"))]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "exists"),
+			newList(), newFunction("all", []*ListNode{}), newList(), newArray([3]ParamsEntry{{0, false, false}, {0, false, false}, {0, false, false}}),
+			newList(), newText("@ > 0"), newList()}, false},
+	{"let", `{let total := count(.items[*])}total is {$total}`, []Node{
+		newList(), newLet("total", newList()), newList(), newFunction("count", []*ListNode{}),
+		newList(), newField("items"), newArray([3]ParamsEntry{{0, false, false}, {0, false, false}, {0, false, false}}),
+		newText("total is "), newList(), newVariable("total"),
+	}, false},
+	{"hexadecimal literal", `{[?(@.size>=0x100)]}`,
+		[]Node{newList(), newFilter(newList(), newList(), ">="),
+			newList(), newField("size"), newList(), newInt(256)}, false},
+	{"upper case hexadecimal literal", `{[?(@.mode==0X1F)]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "=="),
+			newList(), newField("mode"), newList(), newInt(31)}, false},
+	{"negative hexadecimal literal", `{[?(@.offset>-0x10)]}`,
+		[]Node{newList(), newFilter(newList(), newList(), ">"),
+			newList(), newField("offset"), newList(), newInt(-16)}, false},
+	{"separated literal", `{[?(@.count==1_000)]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "=="),
+			newList(), newField("count"), newList(), newInt(1000)}, false},
+	{"separated hexadecimal literal", `{[?(@.mask==0xFF_FF)]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "=="),
+			newList(), newField("mask"), newList(), newInt(65535)}, false},
+	{"leading zero literal", `{[?(@.count==010)]}`,
+		[]Node{newList(), newFilter(newList(), newList(), "=="),
+			newList(), newField("count"), newList(), newInt(10)}, false},
 }
 
 func collectNode(nodes []Node, cur Node) []Node {
@@ -99,6 +163,12 @@ func collectNode(nodes []Node, cur Node) []Node {
 		for _, node := range cur.(*UnionNode).Nodes {
 			nodes = collectNode(nodes, node)
 		}
+	case NodeFunction:
+		for _, node := range cur.(*FunctionNode).Args {
+			nodes = collectNode(nodes, node)
+		}
+	case NodeLet:
+		nodes = collectNode(nodes, cur.(*LetNode).Value)
 	}
 	return nodes
 }
@@ -142,6 +212,25 @@ func TestFailParser(t *testing.T) {
 		{"unterminated array", "{[1}", "unterminated array"},
 		{"unterminated filter", "{[?(.price]}", "unterminated filter"},
 		{"invalid multiple recursive descent", "{........}", "invalid multiple recursive descent"},
+		{"unterminated function call", "{length(.items}", "unterminated function call length"},
+		{"empty function argument", "{concat(.a,,.b)}", "empty argument in function call concat"},
+		{"missing pipe function", "{.items | }", "missing function name after |"},
+		{"pipe range", "{range .items | sum}", "cannot pipe range to function sum"},
+		{"let without name", "{let := .a}", "missing variable name after let"},
+		{"let without assignment", "{let a .a}", "missing := after let a"},
+		{"let inside action", "{.a let b := .c}", "let must start an action"},
+		{"nested namespaces", "{a:b:c(.x)}", "invalid function name a:b:c"},
+		{"function arity", "{match(.a)}", "function match expects 2 or 3 arguments, got 1 at position 1"},
+		{"function arity in filter", "{[?(sum(@.a, @.b))]}", "function sum expects 1 argument, got 2 at position 4"},
+		{"function arity in right operand", "{[?(@.a == lower(.b, .c))]}", "function lower expects 1 argument, got 2 at position 11"},
+		{"nested function arity", "{concat(.a, upper(.b, .c))}", "function upper expects 1 argument, got 2 at position 12"},
+		{"function without arguments", "{coalesce()}", "function coalesce expects at least 1 argument, got 0 at position 1"},
+		{"pipe arity", "{.items | window}", "function window expects 3 arguments, got 1 at position 10"},
+		{"invalid hexadecimal literal", "{0x}", "cannot parse number 0x"},
+		{"trailing separator", "{[?(@.count==1_000_)]}", "cannot parse number 1_000_"},
+		{"double separator", "{[?(@.count==1__000)]}", "cannot parse number 1__000"},
+		{"separated float", "{[?(@.size==1_000.5)]}", "cannot parse number 1_000.5"},
+		{"project arity", `{project {"n": sum(.a, .b)}}`, "function sum expects 1 argument, got 2 at position 15"},
 	}
 	for _, test := range failParserTests {
 		_, err := Parse(test.name, test.text)
@@ -156,3 +245,168 @@ func TestFailParser(t *testing.T) {
 		}
 	}
 }
+
+func TestStrictEscapes(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		strict bool
+		expect []Node
+		err    string
+	}{
+		{"literal backslash", `a\tb`, false, []Node{newText(`a\tb`)}, ""},
+		{"literal backslash between actions", `{.a}\{.b}`, false,
+			[]Node{newList(), newText(`\`), newList()}, ""},
+		{"strict backslash", `a\tb`, true, nil, `unexpected \ in unquoted text at position 1`},
+		{"strict backslash between actions", `{.a}\{.b}`, true, nil, `unexpected \ in unquoted text at position 4`},
+		{"strict without backslash", `a{.b}`, true, []Node{newText("a"), newList()}, ""},
+		{"strict quoted escape", `{"\t"}`, true, []Node{newList()}, ""},
+		{"strict escaped field", `{.a\.b}`, true, []Node{newList()}, ""},
+	}
+	for _, test := range tests {
+		p := NewParser(test.name)
+		p.strictEscapes = test.strict
+		err := p.Parse(test.text)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("in %s, expect to get error %v, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("in %s, parse error %v", test.name, err)
+			continue
+		}
+		if len(p.Root.Nodes) != len(test.expect) {
+			t.Errorf("in %s, expect %d nodes, got %v", test.name, len(test.expect), p.Root.Nodes)
+			continue
+		}
+		for i, node := range p.Root.Nodes {
+			if node.Type() != test.expect[i].Type() {
+				t.Errorf("in %s, expect node %d to be %v, got %v", test.name, i, test.expect[i], node)
+			} else if text, ok := test.expect[i].(*TextNode); ok && node.(*TextNode).Text != text.Text {
+				t.Errorf("in %s, expect text %q, got %q", test.name, text.Text, node.(*TextNode).Text)
+			}
+		}
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	tests := []struct {
+		name      string
+		commented string
+		plain     string
+	}{
+		{"filter", `{.items[?( /* running only */ @.status.phase=="Running")].metadata.name}`,
+			`{.items[?(@.status.phase=="Running")].metadata.name}`},
+		{"before operator", `{.items[?(@.x /* at least */ >= 2)]}`, `{.items[?(@.x >= 2)]}`},
+		{"start of action", `{/* names */ .items[*].name}`, `{.items[*].name}`},
+		{"end of action", `{.items[*].name /* all */}`, `{.items[*].name}`},
+		{"function arguments", `{concat(.a, /* then */ .b)}`, `{concat(.a, .b)}`},
+		{"pipe", `{.items | /* count */ length}`, `{.items | length}`},
+		{"multiline", "{range .items[*] /* each\nitem */}{.name}{end}", `{range .items[*]}{.name}{end}`},
+		{"comment in quotes", `{.items[?(@.name == " /* not a comment */ ")]}`, `{.items[?(@.name == " /* not a comment */ ")]}`},
+		{"comment in text", `/* text */{.a}`, `/* text */{.a}`},
+		{"slash in key", `{.labels.web/html}`, `{.labels.web/html}`},
+	}
+	for _, test := range tests {
+		commented, err := Parse(test.name, test.commented)
+		if err != nil {
+			t.Errorf("in %s, parse error %v", test.name, err)
+			continue
+		}
+		plain, err := Parse(test.name, test.plain)
+		if err != nil {
+			t.Errorf("in %s, parse error %v", test.name, err)
+			continue
+		}
+		got := collectNode([]Node{}, commented.Root)
+		expect := collectNode([]Node{}, plain.Root)
+		if len(got) != len(expect) {
+			t.Errorf("in %s, expect %d nodes, got %v", test.name, len(expect), got)
+			continue
+		}
+		for i := range expect {
+			if got[i].String() != expect[i].String() {
+				t.Errorf("in %s, %dth node, expect %v, got %v", test.name, i, expect[i], got[i])
+			}
+		}
+	}
+
+	failTests := []failParserTest{
+		{"unterminated comment", `{.items[*] /* all}`, "unterminated comment at position 11"},
+		{"unterminated comment in filter", `{[?(@.x /* > 1)]}`, "unterminated comment at position 8"},
+	}
+	for _, test := range failTests {
+		_, err := Parse(test.name, test.text)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("in %s, expect to get error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestUnquotedFieldOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		pos      int
+		message  string
+	}{
+		{"pipe", `{.a|b}`, 3, "field name containing | has to be quoted, e.g. ['a|b']"},
+		{"pipe after path", `{.spec.a|b.c}`, 8, "field name containing | has to be quoted, e.g. ['a|b']"},
+		{"parent", `{.x.a^b}`, 5, "field name containing ^ has to be quoted, e.g. ['a^b'], or escaped"},
+	}
+	for _, test := range tests {
+		err := New(test.name).Parse(test.template)
+		var syntaxErr SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("in %s, expect a SyntaxError, got %v", test.name, err)
+			continue
+		}
+		if syntaxErr.Position() != test.pos || syntaxErr.Message() != test.message {
+			t.Errorf("in %s, expect %q at %d, got %q at %d", test.name, test.message, test.pos, syntaxErr.Message(), syntaxErr.Position())
+		}
+	}
+
+	valid := []string{`{.a|sum}`, `{.a | b}`, `{..a^.b}`, `{.a^^}`, `{.a\^b}`, `{['a|b']}`, `{['a^b']}`}
+	for _, template := range valid {
+		if err := New("valid").Parse(template); err != nil {
+			t.Errorf("expect %s to parse, got %v", template, err)
+		}
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		caret   string
+		message string
+	}{
+		{"unrecognized character", `{.a *}`, "    ^", "unrecognized character in action: U+002A '*'"},
+		{"unrecognized character after text", `pods: {.items[0] #}`, "                 ^", "unrecognized character in action: U+0023 '#'"},
+		{"function arity", `{.a}{match(.b)}`, "     ^", "function match expects 2 or 3 arguments, got 1"},
+		{"function arity in filter", `{.items[?(sum(@.a, @.b))]}`, "          ^", "function sum expects 1 argument, got 2"},
+		{"unterminated comment", `{.a /* b}`, "    ^", "unterminated comment"},
+		{"unclosed action", `{.a`, "   ^", "unclosed action"},
+		{"unquoted field containing ^", `{.a^b}`, "   ^", "field name containing ^ has to be quoted, e.g. ['a^b'], or escaped"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.name, test.text)
+		var syntaxErr SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("in %s, expect a SyntaxError, got %v", test.name, err)
+			continue
+		}
+		if pos := len(test.caret) - 1; syntaxErr.Position() != pos {
+			t.Errorf("in %s, expect position %d, got %d\n%s\n%s", test.name, pos, syntaxErr.Position(),
+				test.text, strings.Repeat(" ", syntaxErr.Position())+"^")
+		}
+		if syntaxErr.Message() != test.message {
+			t.Errorf("in %s, expect message %q, got %q", test.name, test.message, syntaxErr.Message())
+		}
+		if syntaxErr.Input() != test.text {
+			t.Errorf("in %s, expect input %q, got %q", test.name, test.text, syntaxErr.Input())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FindPaths returns the normalized path of every value found by the template, in the
+// order in which Execute would print them. A normalized path starts with $ followed by a
+// bracketed segment per step into the data: array indexes as numbers, and map keys and
+// struct field names as single quoted strings, e.g. $['items'][0]['metadata']['name'].
+// Values which are not part of the data, like the results of functions, cause an error.
+func (j *JSONPath) FindPaths(data interface{}) ([]string, error) {
+	fullResults, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, results := range fullResults {
+		for _, result := range results {
+			if result.text {
+				continue
+			}
+			path, ok := result.path()
+			if !ok {
+				return nil, fmt.Errorf("result %v is not part of the data", result.value)
+			}
+			paths = append(paths, normalizedPath(path))
+		}
+	}
+	return paths, nil
+}
+
+// normalizedPath formats the keys leading from the root of the data to a value as a
+// normalized path, see FindPaths
+func normalizedPath(path []interface{}) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, key := range path {
+		if index, ok := key.(int); ok {
+			fmt.Fprintf(&b, "[%d]", index)
+			continue
+		}
+		b.WriteString("['")
+		for _, r := range fmt.Sprint(key) {
+			switch r {
+			case '\'':
+				b.WriteString(`\'`)
+			case '\\':
+				b.WriteString(`\\`)
+			case '\b':
+				b.WriteString(`\b`)
+			case '\f':
+				b.WriteString(`\f`)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\t':
+				b.WriteString(`\t`)
+			default:
+				if r < 0x20 {
+					fmt.Fprintf(&b, `\u%04x`, r)
+				} else {
+					b.WriteRune(r)
+				}
+			}
+		}
+		b.WriteString("']")
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFindPaths(t *testing.T) {
+	var pointsData interface{}
+	err := json.Unmarshal([]byte(`[
+		{"id": "i1", "x":4, "y":-5},
+		{"id": "i2", "x":-2, "y":-5, "z":1},
+		{"id": "i3", "x":  8, "y":  3 },
+		{"id": "i4", "x": -6, "y": -1 },
+		{"id": "i5", "x":  0, "y":  2, "z": 1 },
+		{"id": "i6", "x":  1, "y":  4 }
+	]`), &pointsData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]interface{}{"it's": "quoted", `a\b`: "backslash", "new\nline": "control"}
+
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		expect   []string
+		err      bool
+	}{
+		{"root", `{@}`, pointsData, []string{"$"}, false},
+		{"index", `{[1].id}`, pointsData, []string{"$[1]['id']"}, false},
+		{"negative index", `{[-1].x}`, pointsData, []string{"$[5]['x']"}, false},
+		{"filter", `{[?(@.z)].id}`, pointsData, []string{"$[1]['id']", "$[4]['id']"}, false},
+		{"slice", `{[2:4].y}`, pointsData, []string{"$[2]['y']", "$[3]['y']"}, false},
+		{"range", `{range [0:2]}{.id}{"\n"}{end}`, pointsData, []string{"$[0]['id']", "$[1]['id']"}, false},
+		{"recursive", `{..z}`, pointsData, []string{"$[1]['z']", "$[4]['z']"}, false},
+		{"escaped names", `{.*}`, labels, []string{`$['a\\b']`, `$['it\'s']`, `$['new\nline']`}, false},
+		{"struct fields", `{.Bicycle[0].Color}`, store{Bicycle: []bicycle{{Color: "red"}}},
+			[]string{"$['Bicycle'][0]['Color']"}, false},
+		{"function result", `{sum(..x)}`, pointsData, nil, true},
+	}
+	for _, test := range tests {
+		j := New(test.name).SortMapKeys(true)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse %s error %v", test.name, test.template, err)
+		}
+		paths, err := j.FindPaths(test.data)
+		if test.err {
+			if err == nil {
+				t.Errorf("in %s, expect error, got %v", test.name, paths)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, test.expect) {
+			t.Errorf("in %s, expect %q, got %q", test.name, test.expect, paths)
+		}
+	}
+}
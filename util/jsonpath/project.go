@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// projection is an object built by a ProjectNode, it keeps the order of its fields
+// when marshaled to JSON
+type projection []projectedField
+
+type projectedField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON writes the fields in the order of the template
+func (p projection) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// evalProject evaluates ProjectNode, building one object for every value. The fields hold
+// the results of their expressions, see collapse.
+func (j *JSONPath) evalProject(input []located, node *ProjectNode) ([]located, error) {
+	// missing keys result in null fields
+	tolerateMissing := j.tolerateMissing
+	j.tolerateMissing = true
+	defer func() { j.tolerateMissing = tolerateMissing }()
+	results := []located{}
+	for _, in := range input {
+		object := make(projection, 0, len(node.Keys))
+		for i, key := range node.Keys {
+			values, err := j.evalList([]located{in}, node.Values[i])
+			if err != nil {
+				return input, err
+			}
+			object = append(object, projectedField{key: key, value: collapse(values)})
+		}
+		results = append(results, located{value: reflect.ValueOf(object)})
+	}
+	return results, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	var input = []byte(`{
+		"kind": "List",
+		"items": [
+			{
+				"metadata": {"name": "pod1", "uid": "u1", "labels": {"app": "web"}},
+				"spec": {"containers": [{"image": "nginx"}, {"image": "busybox"}]}
+			},
+			{
+				"metadata": {"name": "pod2", "uid": "u2"},
+				"spec": {"containers": [{"image": "redis"}]}
+			}
+		]
+	}`)
+	var pods interface{}
+	if err := json.Unmarshal(input, &pods); err != nil {
+		t.Fatal(err)
+	}
+	count := func(args ...[]reflect.Value) ([]reflect.Value, error) {
+		return []reflect.Value{reflect.ValueOf(len(args[0]))}, nil
+	}
+	tests := []jsonpathTest{
+		{"reshape", `{range .items[*]}{project {"id": .metadata.uid, "name": .metadata.name}}{end}`, pods,
+			`{"id":"u1","name":"pod1"}{"id":"u2","name":"pod2"}`, false},
+		{"fields in template order", `{range .items[0]}{project {"name": .metadata.name, "id": .metadata.uid}}{end}`, pods,
+			`{"name":"pod1","id":"u1"}`, false},
+		{"several results", `{range .items[0]}{project {"images": .spec.containers[*].image}}{end}`, pods,
+			`{"images":["nginx","busybox"]}`, false},
+		{"missing value", `{range .items[1]}{project {"app": .metadata.labels.app}}{end}`, pods,
+			`{"app":null}`, false},
+		{"nested object", `{range .items[1]}{project {"meta": {"id": .metadata.uid}, "kind": $.kind}}{end}`, pods,
+			`{"meta":{"id":"u2"},"kind":"List"}`, false},
+		{"literals and functions", `{range .items[0]}{project {"source": "api", "containers": count(.spec.containers[*])}}{end}`, pods,
+			`{"source":"api","containers":2}`, false},
+		{"slice in expression", `{project {"first": .items[0:1].metadata.name}}`, pods, `{"first":"pod1"}`, false},
+		{"quoted key with separators", `{project {"a, b: c": .kind}}`, pods, `{"a, b: c":"List"}`, false},
+		{"empty object", `{project {}}`, pods, `{}`, false},
+	}
+	testJSONPathWithSetup(tests, func(j *JSONPath) { j.RegisterFunction("count", count) }, t)
+
+	j := New("json")
+	j.EnableJSONOutput(true)
+	if err := j.Parse(`{project {"names": .items[*].metadata.name}}`); err != nil {
+		t.Fatal(err)
+	}
+	values, err := j.ExecuteToValues(pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := json.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `[{"names":["pod1","pod2"]}]`; string(text) != expect {
+		t.Errorf("expect %s, got %s", expect, text)
+	}
+}
+
+func TestFailProject(t *testing.T) {
+	tests := []failParserTest{
+		{"no object", `{project .a}`, "project expects an object"},
+		{"unterminated object", `{project {"a": .a`, "unterminated object in project"},
+		{"unquoted key", `{project {a: .a}}`, "invalid key a in project, keys must be quoted"},
+		{"missing expression", `{project {"a": }}`, "missing expression for key a in project"},
+		{"missing colon", `{project {"a"}}`, `invalid entry "a" in project, expect "key": expression`},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.name, test.text)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("in %s, expect error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FindRawJSON returns the original bytes of every value of the JSON document matched by
+// the query, e.g. $.items[0] or {.items[*].metadata}, preserving formatting and key order.
+// The returned slices share memory with jsonBytes.
+func FindRawJSON(query string, jsonBytes []byte) ([][]byte, error) {
+	if !strings.Contains(query, "{") {
+		query = "{" + query + "}"
+	}
+	j := New("raw")
+	if err := j.Parse(query); err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(jsonBytes, &data); err != nil {
+		return nil, err
+	}
+	fullResults, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	raw := [][]byte{}
+	for _, results := range fullResults {
+		for _, result := range results {
+			path, ok := result.path()
+			if !ok {
+				return nil, fmt.Errorf("result %v is not part of the input", result.value)
+			}
+			value, err := rawValue(jsonBytes, path)
+			if err != nil {
+				return nil, err
+			}
+			raw = append(raw, value)
+		}
+	}
+	return raw, nil
+}
+
+// rawValue returns the bytes of the value found by following the path of object keys
+// and array indexes through the JSON document
+func rawValue(jsonBytes []byte, path []interface{}) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(jsonBytes))
+	for _, key := range path {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case json.Delim('{'):
+			if err := skipToKey(dec, fmt.Sprint(key)); err != nil {
+				return nil, err
+			}
+		case json.Delim('['):
+			index, ok := key.(int)
+			if !ok {
+				return nil, fmt.Errorf("%v is not an array index", key)
+			}
+			for i := 0; i < index; i++ {
+				if err := skipValue(dec); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("cannot find %v in %v", key, token)
+		}
+	}
+	var value json.RawMessage
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	end := int(dec.InputOffset())
+	return jsonBytes[end-len(value) : end], nil
+}
+
+// skipToKey advances the decoder, positioned inside an object, to the value of the given key
+func skipToKey(dec *json.Decoder, key string) error {
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if token == key {
+			return nil
+		}
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%s is not found", key)
+}
+
+// skipValue advances the decoder past the next value
+func skipValue(dec *json.Decoder) error {
+	var value json.RawMessage
+	return dec.Decode(&value)
+}
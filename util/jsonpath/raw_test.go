@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindRawJSON(t *testing.T) {
+	input := []byte(`{
+	"kind": "List",
+	"items": [
+		{"metadata": {"name": "pod1", "labels": {"b": "2", "a": "1"}},  "spec": {"replicas": 1}},
+		{"metadata": {"name": "pod2"}, "spec": {"replicas": 2.50}}
+	]
+}`)
+	item0 := `{"metadata": {"name": "pod1", "labels": {"b": "2", "a": "1"}},  "spec": {"replicas": 1}}`
+
+	tests := []struct {
+		name   string
+		query  string
+		expect []string
+		err    bool
+	}{
+		{"first item", `$.items[0]`, []string{item0}, false},
+		{"braced", `{.items[0]}`, []string{item0}, false},
+		{"key order preserved", `$.items[0].metadata.labels`, []string{`{"b": "2", "a": "1"}`}, false},
+		{"number formatting preserved", `{.items[*].spec.replicas}`, []string{`1`, `2.50`}, false},
+		{"string", `$.kind`, []string{`"List"`}, false},
+		{"filter", `{.items[?(@.spec.replicas>2.0)].metadata}`, []string{`{"name": "pod2"}`}, false},
+		{"root", `{$}`, []string{string(input)}, false},
+		{"literal", `{"text"}`, nil, true},
+		{"missing", `$.items[0].status`, nil, true},
+	}
+	for _, test := range tests {
+		raw, err := FindRawJSON(test.query, input)
+		if test.err {
+			if err == nil {
+				t.Errorf("in %s, expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		got := []string{}
+		for _, r := range raw {
+			got = append(got, string(r))
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("in %s, expect %q, got %q", test.name, test.expect, got)
+		}
+	}
+
+	if _, err := FindRawJSON(`$.items`, []byte(`{"items": [`)); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/client-go/third_party/forked/golang/template"
+)
+
+// Settable is a value found by a template which can be replaced within the data the
+// template was executed on.
+type Settable struct {
+	loc located
+}
+
+// Value returns the value found by the template.
+func (s Settable) Value() reflect.Value {
+	return s.loc.value
+}
+
+// Set replaces the value within the data. Values of maps and elements of slices can always
+// be replaced, elements of arrays and fields of structs only if they are reachable through
+// a pointer or a slice, e.g. the data was passed as a pointer. The new value must be
+// assignable or convertible to the type of the replaced value, nil sets the zero value.
+func (s Settable) Set(newValue interface{}) error {
+	if s.loc.parent != nil {
+		parent, isNil := template.Indirect(s.loc.parent.value)
+		if !isNil && parent.Kind() == reflect.Map {
+			key, err := mapKey(parent, s.loc.key)
+			if err != nil {
+				return err
+			}
+			value, err := assignable(newValue, parent.Type().Elem())
+			if err != nil {
+				return err
+			}
+			parent.SetMapIndex(key, value)
+			return nil
+		}
+	}
+	target := s.loc.value
+	if s.loc.root && target.Kind() == reflect.Ptr && !target.IsNil() {
+		// the data itself is replaced through the pointer it was passed as
+		target = target.Elem()
+	}
+	if !target.CanSet() {
+		return fmt.Errorf("value at %v cannot be set, the data must be passed as a pointer", s.loc.key)
+	}
+	value, err := assignable(newValue, target.Type())
+	if err != nil {
+		return err
+	}
+	target.Set(value)
+	return nil
+}
+
+// mapKey returns the key of the map entry, the key of a located value is printed if the
+// map is not keyed by strings
+func mapKey(m reflect.Value, key interface{}) (reflect.Value, error) {
+	keyType := m.Type().Key()
+	if k := reflect.ValueOf(key); k.Kind() == reflect.String && keyType.Kind() == reflect.String {
+		return k.Convert(keyType), nil
+	}
+	for _, k := range m.MapKeys() {
+		if fmt.Sprint(k.Interface()) == fmt.Sprint(key) {
+			return k, nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("key %v is not found", key)
+}
+
+// assignable returns the value converted to the given type
+func assignable(value interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return reflect.Zero(t), nil
+	}
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	// converting numbers to strings would yield runes
+	if v.Type().ConvertibleTo(t) && (t.Kind() != reflect.String || v.Kind() == reflect.String) {
+		return v.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("%s is not assignable to %s", v.Type(), t)
+}
+
+// FindSettable returns the values found by the template in a form which allows replacing
+// them within the data. Text of the template and values computed by functions are omitted.
+func (j *JSONPath) FindSettable(data interface{}) ([]Settable, error) {
+	fullResult, err := j.findLocatedResults(data)
+	if err != nil {
+		return nil, err
+	}
+	results := []Settable{}
+	for _, r := range fullResult {
+		for _, l := range r {
+			if !l.text && (l.parent != nil || l.root) {
+				results = append(results, Settable{loc: l})
+			}
+		}
+	}
+	return results, nil
+}
+
+// SetAll replaces all values found by the template with newValue, see Settable.Set, and
+// returns the number of replaced values. The data must be passed as a pointer.
+func (j *JSONPath) SetAll(data interface{}, newValue interface{}) (int, error) {
+	if reflect.ValueOf(data).Kind() != reflect.Ptr {
+		return 0, fmt.Errorf("data must be passed as a pointer to be modified, got %T", data)
+	}
+	settables, err := j.FindSettable(data)
+	if err != nil {
+		return 0, err
+	}
+	for i, s := range settables {
+		if err := s.Set(newValue); err != nil {
+			return i, err
+		}
+	}
+	return len(settables), nil
+}
+
+// DeleteAll removes all values found by the template from the maps and slices containing
+// them and returns the number of removed values. Map entries can always be removed, slices
+// are replaced by copies without the removed elements, so they must be reachable through
+// a pointer or stored in a map. Fields of structs cannot be removed.
+func (j *JSONPath) DeleteAll(data interface{}) (int, error) {
+	fullResult, err := j.findLocatedResults(data)
+	if err != nil {
+		return 0, err
+	}
+	type sliceRemoval struct {
+		slice   located
+		indices map[int]bool
+	}
+	removals := map[containerKey]*sliceRemoval{}
+	// slices are rebuilt in the order in which they were found
+	order := []containerKey{}
+	count := 0
+	for _, r := range fullResult {
+		for _, l := range r {
+			if l.text || l.parent == nil {
+				continue
+			}
+			parent, isNil := template.Indirect(l.parent.value)
+			if isNil {
+				continue
+			}
+			switch parent.Kind() {
+			case reflect.Map:
+				key, err := mapKey(parent, l.key)
+				if err != nil {
+					return count, err
+				}
+				if parent.MapIndex(key).IsValid() {
+					parent.SetMapIndex(key, reflect.Value{})
+					count++
+				}
+			case reflect.Slice:
+				key, _ := containerKeyOf(parent)
+				removal, ok := removals[key]
+				if !ok {
+					removal = &sliceRemoval{slice: *l.parent, indices: map[int]bool{}}
+					removals[key] = removal
+					order = append(order, key)
+				}
+				removal.indices[l.key.(int)] = true
+			default:
+				return count, fmt.Errorf("value at %v cannot be deleted from %s", l.key, parent.Kind())
+			}
+		}
+	}
+	for _, key := range order {
+		removal := removals[key]
+		slice, _ := template.Indirect(removal.slice.value)
+		kept := reflect.MakeSlice(slice.Type(), 0, slice.Len()-len(removal.indices))
+		for i := 0; i < slice.Len(); i++ {
+			if !removal.indices[i] {
+				kept = reflect.Append(kept, slice.Index(i))
+			}
+		}
+		if err := (Settable{loc: removal.slice}).Set(kept.Interface()); err != nil {
+			return count, err
+		}
+		count += len(removal.indices)
+	}
+	return count, nil
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindSettable(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	type list struct {
+		Items []item `json:"items"`
+	}
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		value    interface{}
+		expect   interface{}
+	}{
+		{
+			name:     "map value",
+			template: `{.labels.app}`,
+			data:     map[string]interface{}{"labels": map[string]interface{}{"app": "web"}},
+			value:    "db",
+			expect:   map[string]interface{}{"labels": map[string]interface{}{"app": "db"}},
+		},
+		{
+			name:     "slice element",
+			template: `{.items[1]}`,
+			data:     map[string]interface{}{"items": []interface{}{1.0, 2.0}},
+			value:    3.0,
+			expect:   map[string]interface{}{"items": []interface{}{1.0, 3.0}},
+		},
+		{
+			name:     "struct fields through a pointer",
+			template: `{.items[*].count}`,
+			data:     &list{Items: []item{{"a", 1}, {"b", 2}}},
+			value:    int64(5),
+			expect:   &list{Items: []item{{"a", 5}, {"b", 5}}},
+		},
+		{
+			name:     "slice element of data passed by value",
+			template: `{.items[1]}`,
+			data:     list{Items: []item{{"a", 1}, {"b", 2}}},
+			value:    item{"c", 3},
+			expect:   list{Items: []item{{"a", 1}, {"c", 3}}},
+		},
+		{
+			name:     "struct fields in a slice of data passed by value",
+			template: `{.items[*].name}`,
+			data:     list{Items: []item{{"a", 1}, {"b", 2}}},
+			value:    "c",
+			expect:   list{Items: []item{{"c", 1}, {"c", 2}}},
+		},
+		{
+			name:     "nil sets the zero value",
+			template: `{.items[0].name}`,
+			data:     &list{Items: []item{{"a", 1}}},
+			value:    nil,
+			expect:   &list{Items: []item{{"", 1}}},
+		},
+		{
+			name:     "map keyed by integers",
+			template: `{.*}`,
+			data:     map[int]string{1: "a"},
+			value:    "b",
+			expect:   map[int]string{1: "b"},
+		},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse error %v", test.name, err)
+		}
+		settables, err := j.FindSettable(test.data)
+		if err != nil {
+			t.Fatalf("in %s, unexpected error %v", test.name, err)
+		}
+		if len(settables) == 0 {
+			t.Fatalf("in %s, expect settable results", test.name)
+		}
+		for _, s := range settables {
+			if err := s.Set(test.value); err != nil {
+				t.Errorf("in %s, unexpected error %v", test.name, err)
+			}
+		}
+		if !reflect.DeepEqual(test.data, test.expect) {
+			t.Errorf("in %s, expect %#v, got %#v", test.name, test.expect, test.data)
+		}
+	}
+}
+
+func TestFindSettableErrors(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		value    interface{}
+		expect   string
+	}{
+		{"struct passed by value", `{.name}`, item{Name: "a"}, "b", "value at name cannot be set, the data must be passed as a pointer"},
+		{"array passed by value", `{[0]}`, [2]string{"a", "b"}, "c", "value at 0 cannot be set, the data must be passed as a pointer"},
+		{"incompatible type", `{.name}`, &item{Name: "a"}, 1, "int is not assignable to string"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse error %v", test.name, err)
+		}
+		settables, err := j.FindSettable(test.data)
+		if err != nil || len(settables) != 1 {
+			t.Fatalf("in %s, expect one settable result, got %v, %v", test.name, settables, err)
+		}
+		err = settables[0].Set(test.value)
+		if err == nil || err.Error() != test.expect {
+			t.Errorf("in %s, expect error %q, got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	type spec struct {
+		Replicas int32 `json:"replicas"`
+	}
+	type deployment struct {
+		Name string `json:"name"`
+		Spec spec   `json:"spec"`
+	}
+	type deploymentList struct {
+		Items []deployment `json:"items"`
+	}
+	list := &deploymentList{Items: []deployment{
+		{Name: "a", Spec: spec{Replicas: 1}},
+		{Name: "b", Spec: spec{Replicas: 2}},
+	}}
+	j := New("replicas")
+	if err := j.Parse(`{.items[*].spec.replicas}`); err != nil {
+		t.Fatal(err)
+	}
+	count, err := j.SetAll(list, 3)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expect 2 replaced values, got %d", count)
+	}
+	for _, item := range list.Items {
+		if item.Spec.Replicas != 3 {
+			t.Errorf("expect replicas of %s to be 3, got %d", item.Name, item.Spec.Replicas)
+		}
+	}
+
+	_, err = j.SetAll(*list, 4)
+	if err == nil || err.Error() != "data must be passed as a pointer to be modified, got jsonpath.deploymentList" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	type container struct {
+		Ports []int `json:"ports"`
+	}
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		count    int
+		expect   interface{}
+	}{
+		{
+			name:     "map entries by filter",
+			template: `{.labels[?(@ == "tmp")]}`,
+			data: map[string]interface{}{"labels": map[string]interface{}{
+				"a": "tmp", "b": "keep", "c": "tmp",
+			}},
+			count:  2,
+			expect: map[string]interface{}{"labels": map[string]interface{}{"b": "keep"}},
+		},
+		{
+			name:     "slice elements by index",
+			template: `{.items[0,2]}`,
+			data:     map[string]interface{}{"items": []interface{}{"a", "b", "c", "d"}},
+			count:    2,
+			expect:   map[string]interface{}{"items": []interface{}{"b", "d"}},
+		},
+		{
+			name:     "slice elements of a struct",
+			template: `{.ports[?(@ > 8000)]}`,
+			data:     &container{Ports: []int{80, 8080, 443, 9090}},
+			count:    2,
+			expect:   &container{Ports: []int{80, 443}},
+		},
+		{
+			name:     "slice passed as a pointer",
+			template: `{[-1]}`,
+			data:     &[]string{"a", "b"},
+			count:    1,
+			expect:   &[]string{"a"},
+		},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse error %v", test.name, err)
+		}
+		count, err := j.DeleteAll(test.data)
+		if err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if count != test.count {
+			t.Errorf("in %s, expect %d deleted values, got %d", test.name, test.count, count)
+		}
+		if !reflect.DeepEqual(test.data, test.expect) {
+			t.Errorf("in %s, expect %#v, got %#v", test.name, test.expect, test.data)
+		}
+	}
+}
+
+func TestDeleteAllErrors(t *testing.T) {
+	type container struct {
+		Name  string `json:"name"`
+		Ports []int  `json:"ports"`
+	}
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		expect   string
+	}{
+		{"struct field", `{.name}`, &container{Name: "a"}, "value at name cannot be deleted from struct"},
+		{"slice not passed as a pointer", `{.ports[0]}`, container{Ports: []int{1}}, "value at ports cannot be set, the data must be passed as a pointer"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse error %v", test.name, err)
+		}
+		_, err := j.DeleteAll(test.data)
+		if err == nil || err.Error() != test.expect {
+			t.Errorf("in %s, expect error %q, got %v", test.name, test.expect, err)
+		}
+	}
+}
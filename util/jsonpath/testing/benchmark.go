@@ -0,0 +1,45 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testing provides helpers to measure the performance of jsonpath templates.
+package testing
+
+import (
+	"io"
+	"testing"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// BenchmarkTemplate parses the template once and measures executing it on data, e.g.
+//
+//	func BenchmarkPodNames(b *testing.B) {
+//		jsonpathtesting.BenchmarkTemplate(b, `{.items[*].metadata.name}`, pods)
+//	}
+func BenchmarkTemplate(b *testing.B, template string, data interface{}) {
+	b.Helper()
+	j := jsonpath.New("benchmark")
+	if err := j.Parse(template); err != nil {
+		b.Fatalf("parse %s error %v", template, err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := j.Execute(io.Discard, data); err != nil {
+			b.Fatalf("execute %s error %v", template, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchmarkData resembles a list of pods with a few hundred items
+func benchmarkData() interface{} {
+	items := []interface{}{}
+	for i := 0; i < 200; i++ {
+		items = append(items, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":   fmt.Sprintf("pod%d", i),
+				"labels": map[string]interface{}{"app": fmt.Sprintf("app%d", i%10), "tier": "backend"},
+			},
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "main", "image": "nginx", "cpu": float64(i % 4)},
+					map[string]interface{}{"name": "sidecar", "image": "envoy", "cpu": 0.5},
+				},
+			},
+			"status": map[string]interface{}{"phase": []string{"Running", "Pending"}[i%2]},
+		})
+	}
+	return map[string]interface{}{"kind": "List", "items": items}
+}
+
+func BenchmarkSingular(b *testing.B) {
+	BenchmarkTemplate(b, `{.items[42].metadata.name}`, benchmarkData())
+}
+
+func BenchmarkWildcard(b *testing.B) {
+	BenchmarkTemplate(b, `{.items[*].metadata.name}`, benchmarkData())
+}
+
+func BenchmarkDescendant(b *testing.B) {
+	BenchmarkTemplate(b, `{..image}`, benchmarkData())
+}
+
+func BenchmarkFilter(b *testing.B) {
+	BenchmarkTemplate(b, `{.items[?(@.status.phase=="Running")].metadata.name}`, benchmarkData())
+}
+
+func BenchmarkRange(b *testing.B) {
+	BenchmarkTemplate(b, `{range .items[*]}{.metadata.name}{"\t"}{.spec.containers[0].image}{"\n"}{end}`, benchmarkData())
+}
+
+func BenchmarkFunction(b *testing.B) {
+	BenchmarkTemplate(b, `{sum(.items[*].spec.containers[*].cpu)}`, benchmarkData())
+}
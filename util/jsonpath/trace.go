@@ -0,0 +1,248 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// TraceBundle is a self-contained record of executing a template, which can be
+// attached to a bug report and replayed with ReplayTraceBundle.
+type TraceBundle struct {
+	Template string          `json:"template"`
+	Options  TraceOptions    `json:"options"`
+	Input    json.RawMessage `json:"input"`
+	Results  [][]interface{} `json:"results"`
+	Output   string          `json:"output"`
+	Error    string          `json:"error,omitempty"`
+	// Trace lists every evaluated node with the number of values it received and returned
+	Trace []string `json:"trace"`
+}
+
+// TraceOptions are the options of the template recorded in a TraceBundle. Registered
+// functions, bound regular expressions, sub-templates and the unknown function handler
+// are code and cannot be recorded, so templates using them cannot be replayed.
+type TraceOptions struct {
+	AllowMissingKeys     bool                   `json:"allowMissingKeys,omitempty"`
+	DescendantKeys       []string               `json:"descendantKeys"`
+	SortMapKeys          bool                   `json:"sortMapKeys,omitempty"`
+	ErrorOnCycles        bool                   `json:"errorOnCycles,omitempty"`
+	MaxDepth             int                    `json:"maxDepth,omitempty"`
+	SkipRangeErrors      bool                   `json:"skipRangeErrors,omitempty"`
+	RelaxedComparisons   bool                   `json:"relaxedComparisons,omitempty"`
+	StrictComparisons    bool                   `json:"strictComparisons,omitempty"`
+	CoerceNumericStrings bool                   `json:"coerceNumericStrings,omitempty"`
+	GlobNames            bool                   `json:"globNames,omitempty"`
+	StrictEscapes        bool                   `json:"strictEscapes,omitempty"`
+	Deduplicate          bool                   `json:"deduplicate,omitempty"`
+	ExportedOnly         bool                   `json:"exportedOnly,omitempty"`
+	LabelQueries         bool                   `json:"labelQueries,omitempty"`
+	EmitNullForMissing   bool                   `json:"emitNullForMissing,omitempty"`
+	MaxOutputBytes       int                    `json:"maxOutputBytes,omitempty"`
+	ContinueOnError      bool                   `json:"continueOnError,omitempty"`
+	ErrorMarker          string                 `json:"errorMarker,omitempty"`
+	JSONOutput           bool                   `json:"jsonOutput,omitempty"`
+	CondensedJSON        bool                   `json:"condensedJSON,omitempty"`
+	CSVOutput            bool                   `json:"csvOutput,omitempty"`
+	CSVColumns           []string               `json:"csvColumns,omitempty"`
+	YAMLOutput           bool                   `json:"yamlOutput,omitempty"`
+	UnwrapSingleResult   bool                   `json:"unwrapSingleResult,omitempty"`
+	PreferStringer       bool                   `json:"preferStringer,omitempty"`
+	Indent               string                 `json:"indent"`
+	TypedOutput          bool                   `json:"typedOutput,omitempty"`
+	OmitEmptyFields      bool                   `json:"omitEmptyFields,omitempty"`
+	FlattenScalars       bool                   `json:"flattenScalars,omitempty"`
+	FlattenDelimiter     string                 `json:"flattenDelimiter,omitempty"`
+	FloatFormat          string                 `json:"floatFormat,omitempty"`
+	IntFormat            string                 `json:"intFormat,omitempty"`
+	DisabledFunctions    []string               `json:"disabledFunctions,omitempty"`
+	Variables            map[string]interface{} `json:"variables,omitempty"`
+}
+
+// traceOptions returns the options of j
+func (j *JSONPath) traceOptions() TraceOptions {
+	return TraceOptions{
+		AllowMissingKeys:     j.allowMissingKeys,
+		DescendantKeys:       sortedKeys(j.descendantKeys),
+		SortMapKeys:          j.sortMapKeys,
+		ErrorOnCycles:        j.errorOnCycles,
+		MaxDepth:             j.maxDepth,
+		SkipRangeErrors:      j.skipRangeErrors,
+		RelaxedComparisons:   j.relaxedComparisons,
+		StrictComparisons:    j.strictComparisons,
+		CoerceNumericStrings: j.coerceNumbers,
+		GlobNames:            j.globNames,
+		StrictEscapes:        j.strictEscapes,
+		Deduplicate:          j.deduplicate,
+		ExportedOnly:         j.exportedOnly,
+		LabelQueries:         j.labelQueries,
+		EmitNullForMissing:   j.emitNullForMissing,
+		MaxOutputBytes:       j.maxOutputBytes,
+		ContinueOnError:      j.continueOnError,
+		ErrorMarker:          j.errorMarker,
+		JSONOutput:           j.outputJSON,
+		CondensedJSON:        j.condensedJSON,
+		CSVOutput:            j.outputCSV,
+		CSVColumns:           j.csvColumns,
+		YAMLOutput:           j.outputYAML,
+		UnwrapSingleResult:   j.unwrapSingleResult,
+		PreferStringer:       j.preferStringer,
+		Indent:               j.indent,
+		TypedOutput:          j.typedOutput,
+		OmitEmptyFields:      j.omitEmptyFields,
+		FlattenScalars:       j.flattenScalars,
+		FlattenDelimiter:     j.flattenDelimiter,
+		FloatFormat:          j.floatFormat,
+		IntFormat:            j.intFormat,
+		DisabledFunctions:    sortedKeys(j.disabledFunctions),
+		Variables:            j.variables,
+	}
+}
+
+// sortedKeys returns the keys of the set in sorted order, or nil for a nil set
+func sortedKeys(set map[string]bool) []string {
+	if set == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setTraceOptions sets the options of j to the recorded ones
+func (j *JSONPath) setTraceOptions(o TraceOptions) {
+	j.allowMissingKeys = o.AllowMissingKeys
+	if o.DescendantKeys != nil {
+		j.RestrictDescendantKeys(o.DescendantKeys)
+	}
+	j.sortMapKeys = o.SortMapKeys
+	j.errorOnCycles = o.ErrorOnCycles
+	j.maxDepth = o.MaxDepth
+	j.skipRangeErrors = o.SkipRangeErrors
+	j.relaxedComparisons = o.RelaxedComparisons
+	j.strictComparisons = o.StrictComparisons
+	j.coerceNumbers = o.CoerceNumericStrings
+	j.globNames = o.GlobNames
+	j.strictEscapes = o.StrictEscapes
+	j.deduplicate = o.Deduplicate
+	j.exportedOnly = o.ExportedOnly
+	j.labelQueries = o.LabelQueries
+	j.emitNullForMissing = o.EmitNullForMissing
+	j.maxOutputBytes = o.MaxOutputBytes
+	j.continueOnError = o.ContinueOnError
+	j.errorMarker = o.ErrorMarker
+	j.outputJSON = o.JSONOutput
+	j.condensedJSON = o.CondensedJSON
+	j.outputCSV = o.CSVOutput
+	j.csvColumns = o.CSVColumns
+	j.outputYAML = o.YAMLOutput
+	j.unwrapSingleResult = o.UnwrapSingleResult
+	j.preferStringer = o.PreferStringer
+	j.indent = o.Indent
+	j.typedOutput = o.TypedOutput
+	j.omitEmptyFields = o.OmitEmptyFields
+	j.flattenScalars = o.FlattenScalars
+	j.flattenDelimiter = o.FlattenDelimiter
+	j.floatFormat = o.FloatFormat
+	j.intFormat = o.IntFormat
+	for _, name := range o.DisabledFunctions {
+		j.UnregisterFunction(name)
+	}
+	for name, value := range o.Variables {
+		j.BindVariable(name, value)
+	}
+}
+
+// ExecuteTraceBundle executes the template on data and returns a JSON serialized TraceBundle.
+// Errors of the execution are recorded in the bundle, an error is only returned if the
+// template is not parsed or the bundle cannot be serialized.
+func (j *JSONPath) ExecuteTraceBundle(data interface{}) ([]byte, error) {
+	if j.parser == nil {
+		return nil, fmt.Errorf("%s is an incomplete jsonpath template", j.name)
+	}
+	input, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	bundle := TraceBundle{
+		Template: j.parser.input,
+		Options:  j.traceOptions(),
+		Input:    input,
+		Results:  [][]interface{}{},
+		Trace:    []string{},
+	}
+
+	exec := j.execution()
+	exec.trace = &bundle.Trace
+	exec.recorded = &bundle.Results
+	if err := exec.executeTraced(&bundle, data); err != nil {
+		bundle.Error = err.Error()
+	}
+	return json.Marshal(bundle)
+}
+
+// executeTraced records the output of the template in the bundle, written like Execute
+// writes it, it must be called on an execution
+func (j *JSONPath) executeTraced(bundle *TraceBundle, data interface{}) error {
+	buf := new(bytes.Buffer)
+	err := j.execute(buf, data)
+	bundle.Output = buf.String()
+	return err
+}
+
+// recordResults appends the values of the results of an action to the bundle
+func (j *JSONPath) recordResults(results []located) {
+	found := make([]interface{}, 0, len(results))
+	for _, r := range results {
+		found = append(found, r.value.Interface())
+	}
+	*j.recorded = append(*j.recorded, found)
+}
+
+// ReplayTraceBundle executes the template of a bundle created by ExecuteTraceBundle on its
+// input again, and returns the resulting bundle.
+func ReplayTraceBundle(bundle []byte) ([]byte, error) {
+	var b TraceBundle
+	if err := json.Unmarshal(bundle, &b); err != nil {
+		return nil, err
+	}
+	j := New("replay")
+	j.setTraceOptions(b.Options)
+	if err := j.Parse(b.Template); err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(b.Input, &data); err != nil {
+		return nil, err
+	}
+	return j.ExecuteTraceBundle(data)
+}
+
+// traceNode records the evaluation of a node
+func (j *JSONPath) traceNode(node Node, input, results []located, err error) {
+	entry := fmt.Sprintf("%s: %d -> %d", node, len(input), len(results))
+	if err != nil {
+		entry += fmt.Sprintf(" (%v)", err)
+	}
+	*j.trace = append(*j.trace, entry)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteTraceBundle(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pod1", "phase": "Running"},
+			map[string]interface{}{"name": "pod2", "phase": "Pending"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		setup    func(j *JSONPath)
+		expect   TraceBundle
+	}{
+		{
+			name:     "results",
+			template: `{range .items[?(@.phase=="Running")]}{.name}{end}`,
+			expect: TraceBundle{
+				Template: `{range .items[?(@.phase=="Running")]}{.name}{end}`,
+				Options:  TraceOptions{Indent: defaultIndent},
+				Input:    json.RawMessage(`{"items":[{"name":"pod1","phase":"Running"},{"name":"pod2","phase":"Pending"}]}`),
+				Results:  [][]interface{}{{"pod1"}},
+				Output:   "pod1",
+			},
+		},
+		{
+			name:     "error",
+			template: `{.items[*].status}`,
+			expect: TraceBundle{
+				Template: `{.items[*].status}`,
+				Options:  TraceOptions{Indent: defaultIndent},
+				Input:    json.RawMessage(`{"items":[{"name":"pod1","phase":"Running"},{"name":"pod2","phase":"Pending"}]}`),
+				Results:  [][]interface{}{},
+				Error:    "status is not found",
+			},
+		},
+		{
+			name:     "missing keys allowed",
+			template: `{.items[*].status}`,
+			setup:    func(j *JSONPath) { j.AllowMissingKeys(true) },
+			expect: TraceBundle{
+				Template: `{.items[*].status}`,
+				Options:  TraceOptions{AllowMissingKeys: true, Indent: defaultIndent},
+				Input:    json.RawMessage(`{"items":[{"name":"pod1","phase":"Running"},{"name":"pod2","phase":"Pending"}]}`),
+				Results:  [][]interface{}{{}},
+			},
+		},
+		{
+			name:     "output options",
+			template: `{.items[?(@.name != $skip)].name}{upper(.items[0].phase)}`,
+			setup: func(j *JSONPath) {
+				j.BindVariable("skip", "pod2")
+				j.EnableTypedOutput(true)
+				j.SetDeduplicateResults(true)
+				j.UnregisterFunction("lower")
+			},
+			expect: TraceBundle{
+				Template: `{.items[?(@.name != $skip)].name}{upper(.items[0].phase)}`,
+				Options: TraceOptions{
+					Deduplicate:       true,
+					Indent:            defaultIndent,
+					TypedOutput:       true,
+					DisabledFunctions: []string{"lower"},
+					Variables:         map[string]interface{}{"skip": "pod2"},
+				},
+				Input:   json.RawMessage(`{"items":[{"name":"pod1","phase":"Running"},{"name":"pod2","phase":"Pending"}]}`),
+				Results: [][]interface{}{{"pod1"}, {"RUNNING"}},
+				Output:  "string:pod1string:RUNNING",
+			},
+		},
+		{
+			name:     "csv with byte limit",
+			template: `{.items[*]}`,
+			setup: func(j *JSONPath) {
+				j.EnableCSVOutput([]string{"{.name}", "{.phase}"})
+				j.SetMaxOutputBytes(20)
+			},
+			expect: TraceBundle{
+				Template: `{.items[*]}`,
+				Options: TraceOptions{
+					MaxOutputBytes: 20,
+					CSVOutput:      true,
+					CSVColumns:     []string{"{.name}", "{.phase}"},
+					Indent:         defaultIndent,
+				},
+				Input: json.RawMessage(`{"items":[{"name":"pod1","phase":"Running"},{"name":"pod2","phase":"Pending"}]}`),
+				Results: [][]interface{}{{
+					map[string]interface{}{"name": "pod1", "phase": "Running"},
+					map[string]interface{}{"name": "pod2", "phase": "Pending"},
+				}},
+				Output: "pod1,Running\npod2,Pe",
+				Error:  ErrOutputTooLarge.Error(),
+			},
+		},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if test.setup != nil {
+			test.setup(j)
+		}
+		if err := j.Parse(test.template); err != nil {
+			t.Fatal(err)
+		}
+		bundle, err := j.ExecuteTraceBundle(data)
+		if err != nil {
+			t.Fatalf("in %s, unexpected error %v", test.name, err)
+		}
+		var got TraceBundle
+		if err := json.Unmarshal(bundle, &got); err != nil {
+			t.Fatalf("in %s, unexpected error %v", test.name, err)
+		}
+		if len(got.Trace) == 0 {
+			t.Errorf("in %s, expect a trace", test.name)
+		}
+		trace := got.Trace
+		got.Trace = nil
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("in %s, expect %+v, got %+v", test.name, test.expect, got)
+		}
+
+		buf := new(bytes.Buffer)
+		err = j.Execute(buf, data)
+		if buf.String() != got.Output {
+			t.Errorf("in %s, expect the output of Execute %q, got %q", test.name, buf.String(), got.Output)
+		}
+		if err != nil && err.Error() != got.Error || err == nil && got.Error != "" {
+			t.Errorf("in %s, expect the error of Execute %v, got %q", test.name, err, got.Error)
+		}
+
+		replayed, err := ReplayTraceBundle(bundle)
+		if err != nil {
+			t.Fatalf("in %s, unexpected replay error %v", test.name, err)
+		}
+		if string(replayed) != string(bundle) {
+			t.Errorf("in %s, expect replay to produce %s, got %s (trace %v)", test.name, bundle, replayed, trace)
+		}
+	}
+
+	if _, err := New("unparsed").ExecuteTraceBundle(data); err == nil {
+		t.Errorf("expect an error for an unparsed template")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ExecuteYAML behaves like Execute on the given YAML document. The document is read like
+// its JSON equivalent: mapping keys become strings, e.g. 1: a is read as "1": "a", and
+// numbers become float64.
+func (j *JSONPath) ExecuteYAML(wr io.Writer, yamlBytes []byte) error {
+	var data interface{}
+	if err := yaml.Unmarshal(yamlBytes, &data); err != nil {
+		return fmt.Errorf("invalid YAML: %v", err)
+	}
+	return j.Execute(wr, data)
+}
+
+// yamlSeparator separates the YAML documents of the results, see EnableYAMLOutput
+const yamlSeparator = "---\n"
+
+// EnableYAMLOutput changes the Execute and PrintResults behavior to write every result as
+// a YAML document, separated by ---, e.g. "a: 1\n---\nb: 2\n". Scalars are documents of
+// their own as well. Structs are encoded by their json tags. The text of the template is
+// skipped.
+func (j *JSONPath) EnableYAMLOutput(v bool) {
+	j.outputYAML = v
+	if v {
+		j.outputJSON = false
+		j.condensedJSON = false
+		j.outputCSV = false
+	}
+}
+
+// executeYAML writes the results of the template as YAML documents, it must be called on
+// an execution
+func (j *JSONPath) executeYAML(wr io.Writer, data interface{}) error {
+	documents := 0
+	err := j.visit(data, func(results []located) error {
+		for _, r := range results {
+			if r.text {
+				continue
+			}
+			if err := j.printYAMLDocument(wr, r.value, documents > 0); err != nil {
+				return err
+			}
+			documents++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return j.continuedErrors()
+}
+
+// printYAML writes the results as YAML documents
+func (j *JSONPath) printYAML(wr io.Writer, results []reflect.Value) error {
+	for i, r := range results {
+		if err := j.printYAMLDocument(wr, r, i > 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printYAMLDocument writes the value as YAML document, preceded by a separator if it is
+// not the first document
+func (j *JSONPath) printYAMLDocument(wr io.Writer, value reflect.Value, separate bool) error {
+	var v interface{}
+	if text, ok, err := textValue(value, j.preferStringer); err != nil {
+		return err
+	} else if ok {
+		v = text
+	} else if value.IsValid() && value.CanInterface() {
+		v = value.Interface()
+		if j.omitEmptyFields {
+			v = withoutEmptyFields(value)
+		}
+	}
+	text, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if separate {
+		if _, err := io.WriteString(wr, yamlSeparator); err != nil {
+			return err
+		}
+	}
+	_, err = wr.Write(text)
+	return err
+}
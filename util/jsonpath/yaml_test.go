@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecuteYAML(t *testing.T) {
+	input := []byte(`
+kind: List
+items:
+- kind: Pod
+  metadata:
+    name: pod1
+    labels:
+      app: web
+  spec:
+    containers:
+    - image: nginx
+      ports:
+      - 80
+      - 443
+- kind: Pod
+  metadata:
+    name: pod2
+  spec:
+    containers:
+    - image: busybox
+codes:
+  1: one
+  true: ok
+`)
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+	}{
+		{"field", `{.kind}`, "List"},
+		{"range", `{range .items[*]}{.metadata.name}:{.spec.containers[0].image} {end}`, "pod1:nginx pod2:busybox "},
+		{"filter", `{.items[?(@.spec.containers[0].image=="busybox")].metadata.name}`, "pod2"},
+		{"numbers", `{.items[0].spec.containers[0].ports[?(@ > 100.0)]}`, "443"},
+		{"object", `{.items[0].metadata.labels}`, `{"app":"web"}`},
+		{"integer key", `{.codes.1}`, "one"},
+		{"boolean key", `{.codes.true}`, "ok"},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse error %v", test.name, err)
+		}
+		buf := new(bytes.Buffer)
+		if err := j.ExecuteYAML(buf, input); err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+
+	j := New("invalid")
+	if err := j.Parse(`{.kind}`); err != nil {
+		t.Fatal(err)
+	}
+	err := j.ExecuteYAML(new(bytes.Buffer), []byte("kind: [List"))
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid YAML: ") {
+		t.Errorf("expect invalid YAML error, got %v", err)
+	}
+}
+
+func TestYAMLOutput(t *testing.T) {
+	storeData := store{
+		Name: "jsonpath",
+		Book: []book{
+			{"reference", "Nigel Rees", "Sayings of the Centurey", 8.95},
+			{"fiction", "Evelyn Waugh", "Sword of Honour", 12.99},
+		},
+		Bicycle: []bicycle{
+			{"red", 19.95, true},
+			{"green", 20.01, false},
+		},
+		Labels: map[string]int{
+			"web/html": 15,
+			"k8s-app":  20,
+		},
+	}
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+	}{
+		{"scalar", `{.Name}`, "jsonpath\n"},
+		{"scalars", `{.Bicycle[*].Color}`, "red\n---\ngreen\n"},
+		{"struct", `{.Bicycle[0]}`, "Color: red\nIsNew: true\nPrice: 19.95\n"},
+		{"structs", `{.Book[*]}`,
+			"Author: Nigel Rees\nCategory: reference\nPrice: 8.95\nTitle: Sayings of the Centurey\n---\n" +
+				"Author: Evelyn Waugh\nCategory: fiction\nPrice: 12.99\nTitle: Sword of Honour\n"},
+		{"map", `{.Labels}`, "k8s-app: 20\nweb/html: 15\n"},
+		{"list", `{.Bicycle[*].IsNew}`, "true\n---\nfalse\n"},
+		{"array", `{.Bicycle}`,
+			"- Color: red\n  IsNew: true\n  Price: 19.95\n- Color: green\n  IsNew: false\n  Price: 20.01\n"},
+		{"actions", `{.Name} has {.Labels.k8s-app}`, "jsonpath\n---\n20\n"},
+		{"range", `{range .Bicycle[*]}{.Color}: {.Price}{"\n"}{end}`, "red\n---\n19.95\n---\ngreen\n---\n20.01\n"},
+		{"no results", `{.Book[?(@.Category == "poetry")]}`, ""},
+	}
+	for _, test := range tests {
+		j := New(test.name)
+		if err := j.Parse(test.template); err != nil {
+			t.Fatalf("in %s, parse error %v", test.name, err)
+		}
+		j.EnableYAMLOutput(true)
+		buf := new(bytes.Buffer)
+		if err := j.Execute(buf, storeData); err != nil {
+			t.Errorf("in %s, unexpected error %v", test.name, err)
+			continue
+		}
+		if buf.String() != test.expect {
+			t.Errorf("in %s, expect to get %q, got %q", test.name, test.expect, buf.String())
+		}
+	}
+
+	j := New("print")
+	j.SetOutputFormat(YAMLOutput)
+	buf := new(bytes.Buffer)
+	results := []reflect.Value{reflect.ValueOf(map[string]int{"a": 1}), reflect.ValueOf("b")}
+	if err := j.PrintResults(buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "a: 1\n---\nb\n"; buf.String() != expect {
+		t.Errorf("expect to get %q, got %q", expect, buf.String())
+	}
+}